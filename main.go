@@ -3,19 +3,30 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
+	"compress/bzip2"
+	"compress/gzip"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"regexp/syntax"
 	"runtime"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
@@ -333,13 +344,153 @@ func isJSON(line string) bool {
 	return jsonEnd != -1
 }
 
+// parseJSONObject parses the first JSON object (or Python dict) in a line, nil if there is none
+func parseJSONObject(line string) map[string]any {
+	for offset := 0; ; {
+		jsonStart := findJSONStart(line[offset:])
+		if jsonStart == -1 {
+			return nil
+		}
+		jsonStart += offset
+		offset = jsonStart + 1
+
+		// Skip arrays and brackets like "[INFO]" before the object
+		if line[jsonStart] != '{' {
+			continue
+		}
+		jsonEnd := findJSONEnd(line, jsonStart)
+		if jsonEnd == -1 {
+			continue
+		}
+		jsonPart := line[jsonStart : jsonEnd+1]
+		var obj map[string]any
+		if json.Unmarshal([]byte(jsonPart), &obj) == nil {
+			return obj
+		}
+		// Try converting from Python dict syntax
+		if json.Unmarshal([]byte(pythonToJSON(jsonPart)), &obj) == nil {
+			return obj
+		}
+	}
+}
+
+// lookupJSON follows a field path ("a.b.0.c") into a parsed JSON value
+func lookupJSON(value any, path []string) (any, bool) {
+	for _, key := range path {
+		switch node := value.(type) {
+		case map[string]any:
+			var ok bool
+			if value, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			value = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonText returns a JSON value as text for comparisons (strings unquoted)
+func jsonText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return "null"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// parseLogfmt parses the key=value pairs of a logfmt line (level=info msg="a b" dur=3ms).
+// Words that aren't pairs are skipped; the first value of a repeated key is kept.
+// A quote that isn't closed is an error rather than a value running to the end of the line.
+func parseLogfmt(line string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' && line[i] != '"' {
+			i++
+		}
+		if i >= len(line) || line[i] != '=' || i == start {
+			// Not a pair, skip the word (and any quoted text in it)
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				if line[i] == '"' {
+					n, ok := quotedLength(line[i:])
+					if !ok {
+						return nil, fmt.Errorf("unterminated quote at column %d", i+1)
+					}
+					i += n
+				} else {
+					i++
+				}
+			}
+			continue
+		}
+		key := line[start:i]
+		i++ // Skip '='
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			n, ok := quotedLength(line[i:])
+			if !ok {
+				return nil, fmt.Errorf("unterminated quote in the value of %s", key)
+			}
+			if unquoted, err := strconv.Unquote(line[i : i+n]); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(line[i:i+n], `"`)
+			}
+			i += n
+		} else {
+			valueStart := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			value = line[valueStart:i]
+		}
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return fields, nil
+}
+
+// quotedLength returns the length of the double-quoted string at the start of s,
+// including the quotes (false if it isn't closed)
+func quotedLength(s string) (int, bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == '"' {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
 type Viewer struct {
-	lines            []string     // All lines from the file
+	lines            []string     // All lines from the file (for mapped files, lines followed after rotation)
 	hasANSI          []bool       // True if corresponding line has ANSI escape codes
+	mapped           *mappedIndex // Line-offset index into a memory-mapped file (nil for in-memory viewers)
+	parent           *Viewer      // Viewer that originIndices point into (filtered views hold no lines)
 	originIndices    []int        // Maps each line to its index in parent viewer (for filtered views)
 	mu               sync.RWMutex // Protects lines during background loading
 	loading          bool         // True while file is still loading
 	filename         string       // Original filename (empty for filtered views)
+	compression      string       // Compression format of the file ("" if not compressed)
 	wordWrap         bool         // Word wrap mode
 	jsonPretty       bool         // JSON pretty-print mode
 	showLineNumbers  bool         // Show line numbers on left side
@@ -349,12 +500,50 @@ type Viewer struct {
 	leftCol          int          // Horizontal scroll offset
 	width            int          // Terminal width
 	height           int          // Terminal height
+	originX, originY int          // Screen position of the view (of its pane when split)
 	expandedCache    map[int]int  // Cache of expanded line counts (lineIdx -> rowCount)
 	expandedCacheKey string       // Key to invalidate cache (mode+width)
-	follow           bool         // Follow mode (like tail -f)
+	follow           atomic.Bool  // Follow mode (like tail -f), toggled by the UI while followers read it
+	notice           string       // Message from a background goroutine for the status bar
+
+	// Follow mode state of the root viewer
+	pollInterval time.Duration  // Poll interval (0 uses file change notifications where available)
+	following    sync.Mutex     // Held by the goroutine currently following
+	follower     *followState   // Followed file, kept across toggles
+	merged       []*followState // Followed files of a multi-file view (set once merged)
+	multiFile    bool           // Lines are merged from several files
+	stream       bool           // Lines arrive through a pipe, following only keeps the view at the end
+
+	// Live filtering: lines appended to the parent are run through match
+	match    func(line string, hasANSI bool) bool // Whether a parent line belongs in this view (nil for the root)
+	scanned  int                                  // Parent lines already run through match
+	children []*Viewer                            // Filtered views updated when lines are appended
+	updating sync.Mutex                           // Serializes updates from the parent
+	before   int                                  // Context lines kept before each match (& -B)
+	after    int                                  // Context lines kept after each match (& -A)
+	trailing int                                  // After-context lines still owed to the last match
+	records  *recordRule                          // Record mode: matches whole records (set on the root to enable it)
+	recStart int                                  // Parent line starting the last record seen
+	recShown int                                  // Lines of that record shown so far
+	base     *Viewer                              // + filters: view whose lines are kept whether they match or not
+	filter   *filterSpec                          // How this view was made from its parent (nil for the root)
+
+	// Filter tree: views filtered from this one stay here when they're left with U
+	branches []*Viewer // Views pushed on top of this one, in the order they were made
+	visited  int       // Index in branches of the one shown last
+
+	marks map[rune]int // Lines marked with m by letter (kept on the root, so filters share them)
+
+	// Notes on lines, kept on the root like marks
+	notes       map[int]string // Notes by line
+	notesKept   []savedNote    // Saved notes whose line wasn't found, written back as they were
+	notesLoaded bool           // Saved notes were looked for once the file loaded
+	notesPlaced []placedNote   // Lines found for kept notes in the background, for Draw to attach (guarded by mu)
+	placing     sync.WaitGroup // The background search for kept notes, which reads the lines
 }
 
-// ViewerStack manages a stack of viewers for filtering navigation
+// ViewerStack manages the tree of filtered views. viewers is the path from the original
+// viewer to the current one; views moved away from stay in the tree as branches.
 type ViewerStack struct {
 	viewers []*Viewer
 }
@@ -366,12 +555,29 @@ type App struct {
 	history            *History // Shared history for filters and searches
 	statusMessage      string
 	messageExpiry      time.Time
-	visualMode         bool   // True when in visual selection mode
-	visualStart        int    // Starting line of visual selection
-	visualStartOffset  int    // Row offset within starting line (for wrap/json mode)
-	visualCursor       int    // Current cursor line in visual mode
-	visualCursorOffset int    // Row offset within cursor line (for wrap/json mode)
-	timestampFormat    string // Python-style datetime format for timestamp search
+	visualMode         bool             // True when in visual selection mode
+	visualStart        int              // Starting line of visual selection
+	visualStartOffset  int              // Row offset within starting line (for wrap/json mode)
+	visualCursor       int              // Current cursor line in visual mode
+	visualCursorOffset int              // Row offset within cursor line (for wrap/json mode)
+	timestampFormat    string           // Python-style datetime format for timestamp search
+	highlights         []*highlightRule // Highlight rules, in the order they are applied
+	levelColors        bool             // Tint lines by their log level
+	jumpLevel          logLevel         // Lowest level e/E jump to
+	panes              []*pane          // Split panes, stack and search are the active one's
+	active             int              // Index of the active pane
+	sideBySide         bool             // Panes are split vertically rather than stacked
+	syncTime           bool             // Other panes scroll to the time of the active one
+	tabs               []*tab           // Open tabs, the current one's panes are the fields above
+	currentTab         int              // Index of the current tab
+	opts               viewerOptions    // Command line options, for files opened in panes and tabs
+}
+
+// pane is a part of the screen with its own filter stack and search
+type pane struct {
+	stack  *ViewerStack
+	search *SearchState
+	format string // Timestamp format for synchronized scrolling ("" until detected)
 }
 
 // History manages persistent command history (for filters and searches)
@@ -417,8 +623,8 @@ func (h *History) save() {
 	os.WriteFile(h.filename, []byte(data), 0644)
 }
 
-// encodeHistoryEntry encodes query with modifiers as "RI|query" where R=r/-, I=i/-
-func encodeHistoryEntry(query string, isRegex, ignoreCase bool) string {
+// encodeHistoryEntry encodes query with modifiers as "RIE|query" where R=r/-, I=i/-, E=e/-
+func encodeHistoryEntry(query string, isRegex, ignoreCase, isExpr bool) string {
 	r := "-"
 	if isRegex {
 		r = "r"
@@ -427,18 +633,26 @@ func encodeHistoryEntry(query string, isRegex, ignoreCase bool) string {
 	if ignoreCase {
 		i = "i"
 	}
-	return r + i + "|" + query
+	e := "-"
+	if isExpr {
+		e = "e"
+	}
+	return r + i + e + "|" + query
 }
 
-// decodeHistoryEntry decodes "RI|query" into query, isRegex, ignoreCase
-func decodeHistoryEntry(entry string) (string, bool, bool) {
+// decodeHistoryEntry decodes "RIE|query" (or "RI|query") into query, isRegex, ignoreCase, isExpr
+func decodeHistoryEntry(entry string) (string, bool, bool, bool) {
+	if len(entry) >= 4 && entry[3] == '|' && strings.ContainsRune("r-", rune(entry[0])) &&
+		strings.ContainsRune("i-", rune(entry[1])) && strings.ContainsRune("e-", rune(entry[2])) {
+		return entry[4:], entry[0] == 'r', entry[1] == 'i', entry[2] == 'e'
+	}
 	if len(entry) >= 3 && entry[2] == '|' {
 		isRegex := entry[0] == 'r'
 		ignoreCase := entry[1] == 'i'
-		return entry[3:], isRegex, ignoreCase
+		return entry[3:], isRegex, ignoreCase, false
 	}
 	// Legacy entry without modifiers
-	return entry, false, false
+	return entry, false, false, false
 }
 
 func (h *History) Add(entry string) {
@@ -453,12 +667,12 @@ func (h *History) Add(entry string) {
 	h.save()
 }
 
-// AddWithModifiers adds entry with regex and ignoreCase flags encoded
-func (h *History) AddWithModifiers(query string, isRegex, ignoreCase bool) {
+// AddWithModifiers adds entry with regex, ignoreCase and expression flags encoded
+func (h *History) AddWithModifiers(query string, isRegex, ignoreCase, isExpr bool) {
 	if query == "" {
 		return
 	}
-	entry := encodeHistoryEntry(query, isRegex, ignoreCase)
+	entry := encodeHistoryEntry(query, isRegex, ignoreCase, isExpr)
 	// Don't add duplicates in a row
 	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
 		return
@@ -485,13 +699,13 @@ func (h *History) Up(currentInput string) string {
 	return h.entries[h.index]
 }
 
-// UpWithModifiers returns query, isRegex, ignoreCase from history
-func (h *History) UpWithModifiers(currentInput string, currentRegex, currentIgnoreCase bool) (string, bool, bool) {
+// UpWithModifiers returns query, isRegex, ignoreCase, isExpr from history
+func (h *History) UpWithModifiers(currentInput string, currentRegex, currentIgnoreCase, currentExpr bool) (string, bool, bool, bool) {
 	if len(h.entries) == 0 {
-		return currentInput, currentRegex, currentIgnoreCase
+		return currentInput, currentRegex, currentIgnoreCase, currentExpr
 	}
 	if h.index == -1 {
-		h.tempInput = encodeHistoryEntry(currentInput, currentRegex, currentIgnoreCase)
+		h.tempInput = encodeHistoryEntry(currentInput, currentRegex, currentIgnoreCase, currentExpr)
 		h.index = len(h.entries) - 1
 	} else if h.index > 0 {
 		h.index--
@@ -511,10 +725,10 @@ func (h *History) Down(currentInput string) string {
 	return h.entries[h.index]
 }
 
-// DownWithModifiers returns query, isRegex, ignoreCase from history
-func (h *History) DownWithModifiers(currentInput string, currentRegex, currentIgnoreCase bool) (string, bool, bool) {
+// DownWithModifiers returns query, isRegex, ignoreCase, isExpr from history
+func (h *History) DownWithModifiers(currentInput string, currentRegex, currentIgnoreCase, currentExpr bool) (string, bool, bool, bool) {
 	if h.index == -1 {
-		return currentInput, currentRegex, currentIgnoreCase
+		return currentInput, currentRegex, currentIgnoreCase, currentExpr
 	}
 	h.index++
 	if h.index >= len(h.entries) {
@@ -530,6 +744,7 @@ type SearchState struct {
 	regex      *regexp.Regexp // Compiled regex pattern
 	isRegex    bool           // True if regex mode is enabled
 	ignoreCase bool           // True if case-insensitive search
+	isExpr     bool           // True if the query is a filter expression
 	matches    []int          // Line indices that match
 	current    int            // Current match index (-1 if none)
 	backward   bool           // True if last search was backward (?)
@@ -541,6 +756,7 @@ func (s *SearchState) Clear() {
 	s.regex = nil
 	s.isRegex = false
 	s.ignoreCase = false
+	s.isExpr = false
 	s.matches = nil
 	s.current = -1
 	s.backward = false
@@ -587,24 +803,39 @@ func (s *SearchState) Prev() int {
 
 // Search performs a search starting from startLine, returns the first match line index or -1
 // If backward is true, searches upward; otherwise searches downward
-// hasANSI is optional cache of which lines have ANSI codes (pass nil to always strip)
-func (s *SearchState) Search(lines []string, hasANSI []bool, query string, startLine int, backward bool, isRegex bool, ignoreCase bool) int {
+// With records set, whole records are matched and the matches are their first lines
+func (s *SearchState) Search(src lineSource, query string, startLine int, backward bool, isRegex bool, ignoreCase bool, isExpr bool, records *recordRule) int {
 	s.query = query
 	s.isRegex = isRegex
 	s.ignoreCase = ignoreCase
+	s.isExpr = isExpr
 	s.matches = nil
 	s.current = -1
 	s.backward = backward
 	s.regex = nil
 
-	totalLines := len(lines)
+	totalLines := src.Len()
 	if totalLines == 0 {
 		return -1
 	}
 
+	// Compile expression if needed, its terms are highlighted (thread-safe for matching)
+	var expr func(line string) bool
+	if isExpr {
+		var highlight string
+		var err error
+		expr, highlight, err = compileExpr(query, ignoreCase)
+		if err != nil {
+			return -1
+		}
+		if highlight != "" {
+			s.regex = regexp.MustCompile(highlight)
+		}
+	}
+
 	// Compile regex if needed (thread-safe for matching)
 	var re *regexp.Regexp
-	if isRegex {
+	if isRegex && !isExpr {
 		pattern := query
 		if ignoreCase {
 			pattern = "(?i)" + pattern
@@ -632,11 +863,12 @@ func (s *SearchState) Search(lines []string, hasANSI []bool, query string, start
 
 	// Precompute lowercase query for case-insensitive search
 	lowerQuery := ""
-	if !isRegex && ignoreCase {
+	if !isRegex && !isExpr && ignoreCase {
 		lowerQuery = strings.ToLower(query)
 	}
 
-	// Start workers
+	// Start workers, fewer than numWorkers when the chunks run out early
+	started := 0
 	for w := 0; w < numWorkers; w++ {
 		start := w * chunkSize
 		end := start + chunkSize
@@ -646,29 +878,38 @@ func (s *SearchState) Search(lines []string, hasANSI []bool, query string, start
 		if start >= totalLines {
 			break
 		}
+		started++
 
 		go func(chunkIdx, start, end int) {
 			var chunkMatches []int
-			for i := start; i < end; i++ {
-				line := lines[i]
+			matches := func(line string, hasANSI bool) bool {
 				// Get plain text (only strip if has ANSI codes)
 				var plainLine string
-				if hasANSI != nil && i < len(hasANSI) && !hasANSI[i] {
+				if !hasANSI {
 					plainLine = line
 				} else {
 					plainLine = stripANSI(line)
 				}
 
-				var matches bool
-				if !isRegex && !ignoreCase {
-					matches = strings.Contains(plainLine, query)
+				if isExpr {
+					return expr(plainLine)
+				} else if !isRegex && !ignoreCase {
+					return strings.Contains(plainLine, query)
 				} else if !isRegex && ignoreCase {
-					matches = strings.Contains(strings.ToLower(plainLine), lowerQuery)
-				} else {
-					matches = re.MatchString(plainLine)
+					return strings.Contains(strings.ToLower(plainLine), lowerQuery)
 				}
+				return re.MatchString(plainLine)
+			}
 
-				if matches {
+			if records != nil {
+				records.forEachRecord(src, start, end, func(recStart, recEnd int) {
+					if matches(recordText(src, recStart, recEnd)) {
+						chunkMatches = append(chunkMatches, recStart)
+					}
+				})
+			}
+			for i := start; i < end && records == nil; i++ {
+				if matches(src.Line(i), src.HasANSI(i)) {
 					chunkMatches = append(chunkMatches, i)
 				}
 			}
@@ -678,11 +919,7 @@ func (s *SearchState) Search(lines []string, hasANSI []bool, query string, start
 
 	// Collect results in order
 	results := make([]searchResult, numWorkers)
-	expectedWorkers := numWorkers
-	if totalLines < numWorkers {
-		expectedWorkers = 1
-	}
-	for i := 0; i < expectedWorkers; i++ {
+	for i := 0; i < started; i++ {
 		result := <-resultChan
 		results[result.chunkIdx] = result
 	}
@@ -720,27 +957,93 @@ func (s *SearchState) Search(lines []string, hasANSI []bool, query string, start
 	return -1
 }
 
-func NewViewer(filename string) (*Viewer, error) {
+// viewerOptions are set on a viewer before it starts loading, the loader reads them
+// once it's done
+type viewerOptions struct {
+	follow       bool          // Follow the input once loaded (not for compressed files)
+	pollInterval time.Duration // Poll interval in follow mode (0 uses file change notifications)
+	records      *recordRule   // Record mode (nil if off)
+}
+
+// newViewer creates a loading viewer with opts applied
+func newViewer(filename string, opts viewerOptions) *Viewer {
+	v := &Viewer{
+		loading:      true,
+		filename:     filename,
+		pollInterval: opts.pollInterval,
+		records:      opts.records,
+	}
+	v.follow.Store(opts.follow)
+	return v
+}
+
+func NewViewer(filename string, opts viewerOptions) (*Viewer, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	v := &Viewer{
-		lines:    nil,
-		loading:  true,
-		filename: filename,
-		topLine:  0,
-		leftCol:  0,
+	v := newViewer(filename, opts)
+
+	info, err := file.Stat()
+	if err == nil && info.Mode().IsRegular() {
+		v.compression = detectCompression(file)
+	}
+	if v.compression != "" {
+		// Compressed files are decoded into memory, there is nothing to follow
+		v.follow.Store(false)
+		r, err := newDecompressor(file, v.compression)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		go func() {
+			defer file.Close()
+			defer r.Close()
+			loadFromReader(v, r)
+		}()
+		return v, nil
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		// Pipes and devices can't be mapped, stream them into memory instead
+		go func() {
+			defer file.Close()
+			loadFromReader(v, file)
+
+			if v.follow.Load() {
+				go v.followFile(filename)
+			}
+		}()
+		return v, nil
 	}
 
-	// Load file in background with batched updates for performance
+	// Map the file and only keep a line-offset index in memory. A followed file is read
+	// into memory instead: a copytruncate would take its lines out of the mapping.
+	var data []byte
+	copied := v.follow.Load()
+	if !copied {
+		if data, err = mmapFile(file, info.Size(), info.Size()); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	v.mapped = &mappedIndex{file: file, data: data, offsets: []int64{0}, copied: copied}
+
+	// Index file in background with batched updates for performance
 	go func() {
-		defer file.Close()
-		loadFromReader(v, file)
+		if copied {
+			// Whatever could be read is indexed, following picks up from there
+			data, _ = v.growMapping(info.Size())
+		}
+		v.indexMapped(data)
+
+		v.mu.Lock()
+		v.loading = false
+		v.mu.Unlock()
+		termbox.Interrupt()
 
 		// If follow mode is enabled, keep watching for new content
-		if v.follow {
+		if v.follow.Load() {
 			go v.followFile(filename)
 		}
 	}()
@@ -748,101 +1051,161 @@ func NewViewer(filename string) (*Viewer, error) {
 	return v, nil
 }
 
-// followFile watches a file for new content and appends it
-func (v *Viewer) followFile(filename string) {
-	for v.follow {
-		time.Sleep(100 * time.Millisecond)
+// compressionFormats maps compression formats to the magic bytes their files start with
+// (bzip2's "BZh" is common text, isBzip2 checks more of it)
+var compressionFormats = []struct {
+	name  string
+	magic []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
 
-		file, err := os.Open(filename)
-		if err != nil {
-			continue
+// detectCompression returns the compression format of a file from its magic bytes, or "" if none
+func detectCompression(file *os.File) string {
+	header := make([]byte, 10)
+	n, _ := file.ReadAt(header, 0)
+	header = header[:n]
+	for _, f := range compressionFormats {
+		if bytes.HasPrefix(header, f.magic) {
+			return f.name
 		}
+	}
+	if isBzip2(header) {
+		return "bzip2"
+	}
+	return ""
+}
 
-		// Get current line count
-		v.mu.RLock()
-		currentLines := len(v.lines)
-		v.mu.RUnlock()
-
-		// Skip to where we left off
-		scanner := bufio.NewScanner(file)
-		buf := make([]byte, 0, 64*1024)
-		scanner.Buffer(buf, 10*1024*1024)
+// isBzip2 reports whether header starts a bzip2 stream: "BZh", the block size digit and
+// the magic of the first block (or of the end of an empty stream)
+func isBzip2(header []byte) bool {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("BZh")) || header[3] < '1' || header[3] > '9' {
+		return false
+	}
+	block := header[4:10]
+	return bytes.Equal(block, []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) ||
+		bytes.Equal(block, []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})
+}
 
-		lineNum := 0
-		var newLines []string
-		var newHasANSI []bool
-		for scanner.Scan() {
-			lineNum++
-			if lineNum > currentLines {
-				line := scanner.Text()
-				newLines = append(newLines, line)
-				newHasANSI = append(newHasANSI, lineHasANSI(line))
-			}
+// newDecompressor wraps r in a reader that decodes the given compression format.
+// zstd and xz aren't in the standard library, so they are piped through the system tools.
+func newDecompressor(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case "zstd", "xz":
+		if _, err := exec.LookPath(format); err != nil {
+			return nil, fmt.Errorf("the %s command is needed to read %s compressed files, install it or decompress the file first", format, format)
 		}
-		file.Close()
+		cmd := exec.Command(format, "-dc")
+		cmd.Stdin = r
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("%s not available to decompress file: %v", format, err)
+		}
+		return &commandReader{out, cmd}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", format)
+}
 
-		if len(newLines) > 0 {
-			// Check if we're at the bottom before adding lines
-			v.mu.RLock()
-			atBottom := v.topLine >= len(v.lines)-v.height
-			v.mu.RUnlock()
+// commandReader reads the output of a decompression command and reaps it on Close
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
 
-			v.mu.Lock()
-			v.lines = append(v.lines, newLines...)
-			v.hasANSI = append(v.hasANSI, newHasANSI...)
-			if atBottom {
-				// Auto-scroll to bottom
-				v.topLine = len(v.lines) - v.height
-				if v.topLine < 0 {
-					v.topLine = 0
-				}
-			}
-			v.mu.Unlock()
+func (c *commandReader) Close() error {
+	c.ReadCloser.Close()
+	return c.cmd.Wait()
+}
 
-			termbox.Interrupt()
-		}
+// openDecompressed opens a file for line-by-line reading, decoding it if it is compressed
+func openDecompressed(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	format := detectCompression(file)
+	if format == "" {
+		return file, nil
+	}
+	r, err := newDecompressor(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
+	return &decompressedFile{r, file}, nil
 }
 
-// NewViewerFromStdin creates a Viewer that reads from stdin
-func NewViewerFromStdin() *Viewer {
-	v := &Viewer{
-		lines:    nil,
-		loading:  true,
-		filename: "<stdin>",
-		topLine:  0,
-		leftCol:  0,
-	}
+// decompressedFile closes both the decoder and the underlying file
+type decompressedFile struct {
+	io.ReadCloser
+	file *os.File
+}
 
-	// Load stdin in background
-	go func() {
-		loadFromReader(v, os.Stdin)
-	}()
+func (d *decompressedFile) Close() error {
+	d.ReadCloser.Close()
+	return d.file.Close()
+}
 
-	return v
+// mappedIndex locates lines inside a memory-mapped file without holding them in memory.
+// A followed file is held in memory instead, but indexed the same way.
+type mappedIndex struct {
+	file    *os.File // Kept open so follow mode can read on as it grows
+	data    []byte   // Bytes of the file (there may be room past them, see growMapping)
+	offsets []int64  // offsets[i] is where line i starts; the last entry is the end of the last complete line
+	tailEnd int64    // End of a trailing line without newline (equals the last offset if there is none)
+	hasANSI []bool   // True if corresponding line has ANSI escape codes
+	head    []byte   // Copy of the start of the file, to tell when it was rewritten in place
+	copied  bool     // data was read into memory rather than mapped (followed files, see copyMapped)
 }
 
-// loadFromReader loads lines from an io.Reader into a Viewer
-func loadFromReader(v *Viewer, r io.Reader) {
-	scanner := bufio.NewScanner(r)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 10*1024*1024)
+// mappedHeadSize is how much of the start of a mapped file is kept to compare
+const mappedHeadSize = 1024
+
+// indexMapped scans data from the end of the current index and appends the offset of
+// every complete line in batches. A trailing line without a newline is only tracked
+// in tailEnd, so it can keep growing while following the file.
+func (v *Viewer) indexMapped(data []byte) {
+	// A fault means the file was truncated while indexing, keep what was indexed so far
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer recoverMemoryFault()
+
+	v.mu.RLock()
+	m := v.mapped
+	pos := m.offsets[len(m.offsets)-1]
+	v.mu.RUnlock()
 
 	const batchSize = 10000
-	batch := make([]string, 0, batchSize)
+	batch := make([]int64, 0, batchSize)
 	batchHasANSI := make([]bool, 0, batchSize)
 	totalLines := 0
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		batch = append(batch, line)
-		batchHasANSI = append(batchHasANSI, lineHasANSI(line))
+	size := int64(len(data))
+	for pos < size {
+		nl := bytes.IndexByte(data[pos:], '\n')
+		if nl < 0 {
+			break
+		}
+		end := pos + int64(nl) + 1
+		batch = append(batch, end)
+		batchHasANSI = append(batchHasANSI, bytes.IndexByte(data[pos:end], 0x1b) >= 0)
+		pos = end
 
 		if len(batch) >= batchSize {
 			v.mu.Lock()
-			v.lines = append(v.lines, batch...)
-			v.hasANSI = append(v.hasANSI, batchHasANSI...)
+			m.data = data
+			m.offsets = append(m.offsets, batch...)
+			m.hasANSI = append(m.hasANSI, batchHasANSI...)
 			v.mu.Unlock()
+			v.notifyChildren()
 			totalLines += len(batch)
 			batch = batch[:0]
 			batchHasANSI = batchHasANSI[:0]
@@ -854,2244 +1217,6958 @@ func loadFromReader(v *Viewer, r io.Reader) {
 		}
 	}
 
-	// Append remaining lines
-	if len(batch) > 0 {
-		v.mu.Lock()
-		v.lines = append(v.lines, batch...)
-		v.hasANSI = append(v.hasANSI, batchHasANSI...)
-		v.mu.Unlock()
-	}
-
+	// Append remaining lines and the unterminated tail
 	v.mu.Lock()
-	v.loading = false
+	m.data = data
+	m.offsets = append(m.offsets, batch...)
+	m.hasANSI = append(m.hasANSI, batchHasANSI...)
+	m.tailEnd = size
+	if n := len(m.head); n < mappedHeadSize {
+		m.head = append(m.head, data[n:min(size, mappedHeadSize)]...)
+	}
 	v.mu.Unlock()
-	termbox.Interrupt()
+	v.notifyChildren()
 }
 
-// NewViewerFromLines creates a Viewer from an existing slice of lines
-func NewViewerFromLines(lines []string) *Viewer {
-	hasANSI := make([]bool, len(lines))
-	for i, line := range lines {
-		hasANSI[i] = lineHasANSI(line)
-	}
-	return &Viewer{
-		lines:    lines,
-		hasANSI:  hasANSI,
-		loading:  false,
-		filename: "", // empty for test viewers
-		topLine:  0,
-		leftCol:  0,
-	}
+// followState tracks a followed file like tail -F: the byte offset and identity of the
+// open file are kept, so a file renamed away by logrotate is replaced by the new file at
+// the same path and a truncated file is read again from the start.
+type followState struct {
+	filename string      // Path being followed
+	prefix   string      // Prefix of lines from this file (multi-file views)
+	file     *os.File    // Handle of the file currently followed (nil until started)
+	info     os.FileInfo // Identity of file, compared with the path to detect rotation
+	offset   int64       // Bytes of file consumed so far
+	pending  []byte      // Start of a line whose newline hasn't been written yet
+	mapped   bool        // Growth is picked up by remapping the file instead of reading it
 }
 
-// LineCount returns the number of lines (thread-safe)
-func (v *Viewer) LineCount() int {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	return len(v.lines)
+// fileWatcher blocks the follower until a followed file may have changed
+type fileWatcher interface {
+	Wait()
+	Close()
 }
 
-// GetLine returns a line at index (thread-safe), or empty string if out of bounds
-func (v *Viewer) GetLine(idx int) string {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	if idx < 0 || idx >= len(v.lines) {
-		return ""
-	}
-	return v.lines[idx]
-}
+// defaultPollInterval is used when file change notifications are unavailable
+const defaultPollInterval = 100 * time.Millisecond
 
-// GetLines returns a copy of lines slice (thread-safe)
-func (v *Viewer) GetLines() []string {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	result := make([]string, len(v.lines))
-	copy(result, v.lines)
-	return result
+// pollWatcher wakes the follower at a fixed interval
+type pollWatcher struct {
+	interval time.Duration
 }
 
-// GetHasANSI returns a copy of hasANSI slice (thread-safe)
-func (v *Viewer) GetHasANSI() []bool {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	result := make([]bool, len(v.hasANSI))
-	copy(result, v.hasANSI)
-	return result
-}
+func (w pollWatcher) Wait()  { time.Sleep(w.interval) }
+func (w pollWatcher) Close() {}
 
-// IsLoading returns true if still loading (thread-safe)
-func (v *Viewer) IsLoading() bool {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	return v.loading
+// newFileWatcher watches filenames with file change notifications (inotify), falling back
+// to polling where they're unavailable. A non-zero pollInterval always polls, for
+// filesystems like NFS where notifications don't report remote writes.
+func newFileWatcher(filenames []string, pollInterval time.Duration) fileWatcher {
+	if pollInterval > 0 {
+		return pollWatcher{pollInterval}
+	}
+	if w, err := newNotifyWatcher(filenames); err == nil {
+		return w
+	}
+	return pollWatcher{defaultPollInterval}
 }
 
-func (v *Viewer) draw() {
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+// followFile watches a file for new content and appends it
+func (v *Viewer) followFile(filename string) {
+	// Toggling follow quickly must not start a second follower
+	if !v.following.TryLock() {
+		return
+	}
+	defer v.following.Unlock()
 
-	// Draw visible lines
-	lineCount := v.LineCount()
-	for screenY := 0; screenY < v.height; screenY++ {
-		lineIndex := v.topLine + screenY
+	// Follow state is kept on the viewer so toggling follow off and on resumes where it stopped
+	if v.follower == nil {
+		v.follower = &followState{filename: filename}
+	}
+	f := v.follower
 
-		// Check if we've run out of lines
-		if lineIndex >= lineCount {
-			break
+	watcher := newFileWatcher([]string{filename}, v.pollInterval)
+	defer watcher.Close()
+
+	// Poll before the first wait, the file may have changed before it was watched
+	for ; v.follow.Load(); watcher.Wait() {
+		// Wait for the initial load, it's still appending lines
+		if v.IsLoading() {
+			continue
 		}
+		if f.file == nil && !v.startFollow(f) {
+			continue
+		}
+		if lines := v.pollFollow(f); len(lines) > 0 {
+			v.appendLines(lines)
+			termbox.Interrupt()
+		}
+	}
+}
 
-		line := v.GetLine(lineIndex)
-		runes := []rune(line)
+// followMerged polls every file of a multi-file view and merges their new lines by timestamp.
+// Lines are merged within each poll; lines already shown are never reordered.
+func (v *Viewer) followMerged() {
+	// Toggling follow quickly must not start a second follower
+	if !v.following.TryLock() {
+		return
+	}
+	defer v.following.Unlock()
 
-		// Draw each character in the line
-		screenX := 0
-		for i, char := range runes {
-			// Skip characters before the horizontal scroll offset
-			if i < v.leftCol {
-				continue
-			}
+	// Files are known once the initial merge is done
+	for v.follow.Load() && v.IsLoading() {
+		time.Sleep(defaultPollInterval)
+	}
+	v.mu.RLock()
+	files := v.merged
+	v.mu.RUnlock()
 
-			// Stop if we've reached the edge of the screen
-			if screenX >= v.width {
-				break
-			}
+	filenames := make([]string, len(files))
+	for i, f := range files {
+		filenames[i] = f.filename
+	}
+	watcher := newFileWatcher(filenames, v.pollInterval)
+	defer watcher.Close()
 
-			termbox.SetCell(screenX, screenY, char, termbox.ColorDefault, termbox.ColorDefault)
-			screenX++
+	for ; v.follow.Load(); watcher.Wait() {
+		var streams []*fileStream
+		for _, f := range files {
+			if lines := v.pollFollow(f); len(lines) > 0 {
+				r := io.NopCloser(strings.NewReader(strings.Join(lines, "\n")))
+				streams = append(streams, newFileStream(r, f.prefix))
+			}
+		}
+		if len(streams) == 0 {
+			continue
 		}
+		mergeStreams(streams, v.records, v.appendLines)
+		termbox.Interrupt()
 	}
+}
 
-	// Draw status bar at the bottom
-	v.drawStatusBar()
-
-	termbox.Flush()
-}
+// startFollow opens the followed file and picks up where the initial load stopped
+func (v *Viewer) startFollow(f *followState) bool {
+	v.mu.RLock()
+	m := v.mapped
+	v.mu.RUnlock()
 
-// drawStatusText clears the status line and draws text (used by multiple status bar functions)
-func drawStatusText(width, statusY int, text string) {
-	for i := 0; i < width; i++ {
-		termbox.SetCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
-	}
-	for i, char := range text {
-		if i >= width {
-			break
+	if m != nil && m.file != nil {
+		// Keep indexing the same file as it grows
+		if !m.copied {
+			v.copyMapped()
 		}
-		termbox.SetCell(i, statusY, char, termbox.ColorBlack, termbox.ColorWhite)
-	}
-}
-
-// buildModeStr returns the mode indicators string
-func (v *Viewer) buildModeStr() string {
-	modeStr := ""
-	if v.follow {
-		modeStr += " [follow]"
-	}
-	if v.wordWrap {
-		modeStr += " [wrap]"
-	}
-	if v.jsonPretty {
-		modeStr += " [json]"
-	}
-	if v.showLineNumbers {
-		modeStr += " [ln]"
-	}
-	if v.stickyLeft > 0 {
-		modeStr += fmt.Sprintf(" [K:%d]", v.stickyLeft)
+		v.mu.RLock()
+		f.offset = int64(len(m.data))
+		v.mu.RUnlock()
+		f.file = m.file
+		f.mapped = true
+	} else {
+		file, err := os.Open(f.filename)
+		if err != nil {
+			return false
+		}
+		f.file = file
+		f.offset, _ = file.Seek(0, io.SeekEnd)
 	}
-	return modeStr
+	f.info, _ = f.file.Stat()
+	return true
 }
 
-func (v *Viewer) drawStatusBar() {
-	v.drawStatusBarWithDepth(1, v.topLine, v.LineCount())
+// pollFollow handles rotation and truncation of the followed file and returns the lines
+// written to it since the last poll
+func (v *Viewer) pollFollow(f *followState) []string {
+	var lines []string
+	stale := f.mapped && v.mappingStale()
+	pathInfo, err := os.Stat(f.filename)
+	if err == nil && f.info != nil && !os.SameFile(f.info, pathInfo) {
+		// Rotated: finish reading the old file, then follow the new one at the same path
+		lines = v.readFollow(f)
+		file, err := os.Open(f.filename)
+		if err != nil {
+			return lines
+		}
+		if !f.mapped {
+			// A mapped file is closed along with its mapping (see release)
+			f.file.Close()
+		}
+		f.file = file
+		f.info, _ = file.Stat()
+		f.offset = 0
+		f.pending = nil
+		f.mapped = false
+		v.setNotice("File rotated, following new " + f.filename)
+	} else if info, err := f.file.Stat(); err == nil && (info.Size() < f.offset || stale) {
+		// Truncated in place (copytruncate), maybe written again since: everything in
+		// the file is new again
+		f.offset = 0
+		f.pending = nil
+		f.mapped = false
+		v.setNotice("File truncated, following " + f.filename + " from start")
+	}
+
+	return append(lines, v.readFollow(f)...)
 }
 
-func (v *Viewer) drawStatusBarWithDepth(depth int, origLine int, origTotal int) {
-	lineCount := v.LineCount()
-	loadingStr := ""
-	if v.IsLoading() {
-		loadingStr = " [loading...]"
+// readFollow returns the complete lines written to the followed file since the last read.
+// A mapped file is indexed in place instead, so no lines are returned for it.
+func (v *Viewer) readFollow(f *followState) []string {
+	info, err := f.file.Stat()
+	if err != nil || info.Size() <= f.offset {
+		return nil
 	}
-	modeStr := v.buildModeStr()
 
-	var status string
-	if depth > 1 {
-		status = fmt.Sprintf(" Line %d/%d | Original %d/%d | Col %d%s%s | Depth %d | q:quit ",
-			v.topLine+1, lineCount, origLine+1, origTotal, v.leftCol, modeStr, loadingStr, depth)
-	} else {
-		status = fmt.Sprintf(" Line %d/%d | Col %d%s%s | Depth %d | q:quit ",
-			v.topLine+1, lineCount, v.leftCol, modeStr, loadingStr, depth)
+	if f.mapped {
+		data, err := v.growMapping(info.Size())
+		if err != nil {
+			// Reading on would need the lines not indexed yet held apart from the mapping
+			v.follow.Store(false)
+			v.setNotice(fmt.Sprintf("Stopped following %s: %v", f.filename, err))
+			return nil
+		}
+		// Check if we're at the bottom before adding lines
+		atBottom := v.topLine >= v.LineCount()-v.height
+		v.indexMapped(data)
+		f.offset = int64(len(data))
+		if atBottom {
+			v.scrollToEnd()
+		}
+		termbox.Interrupt()
+		return nil
 	}
 
-	drawStatusText(v.width, v.height, status)
+	var lines []string
+	const chunkSize = 4 * 1024 * 1024
+	for f.offset < info.Size() {
+		buf := make([]byte, min(info.Size()-f.offset, chunkSize))
+		n, _ := f.file.ReadAt(buf, f.offset)
+		if n == 0 {
+			break
+		}
+		f.offset += int64(n)
 
-	// Draw right-aligned filename
-	if v.filename != "" {
-		filenameDisplay := " " + v.filename + " "
-		startX := v.width - len([]rune(filenameDisplay))
-		if startX > len(status) {
-			for i, char := range filenameDisplay {
-				termbox.SetCell(startX+i, v.height, char, termbox.ColorBlack, termbox.ColorWhite)
+		// Only complete lines are returned, the rest waits for its newline
+		data := append(f.pending, buf[:n]...)
+		for {
+			nl := bytes.IndexByte(data, '\n')
+			if nl < 0 {
+				break
 			}
+			lines = append(lines, strings.TrimSuffix(string(data[:nl]), "\r"))
+			data = data[nl+1:]
 		}
+		f.pending = append([]byte(nil), data...)
 	}
+	return lines
 }
 
-// showMessage displays a message on the status bar
-func (v *Viewer) showMessage(msg string) {
-	drawStatusText(v.width, v.height, msg)
-	termbox.Flush()
-}
+// mappingStale reports whether the indexed file of v was truncated below the lines
+// indexed in it or rewritten in place since (its start changed). Its lines are kept in
+// memory, but new ones can't be indexed after them anymore.
+func (v *Viewer) mappingStale() bool {
+	v.mu.RLock()
+	m := v.mapped
+	if m == nil || m.file == nil {
+		v.mu.RUnlock()
+		return false
+	}
+	end, head := m.tailEnd, m.head
+	v.mu.RUnlock()
 
-// drawVisualStatusBar draws the status bar in visual mode
-func (a *App) drawVisualStatusBar(v *Viewer, status string) {
-	drawStatusText(v.width, v.height, status)
+	info, err := m.file.Stat()
+	if err != nil || info.Size() < end {
+		return true
+	}
+	start := make([]byte, len(head))
+	n, _ := m.file.ReadAt(start, 0)
+	return !bytes.Equal(start[:n], head)
 }
 
-// drawStatusBarWithSearch draws the status bar including search info
-func (a *App) drawStatusBarWithSearch(v *Viewer, depth int, origLine int, origTotal int, searchInfo string) {
-	lineCount := v.LineCount()
-	loadingStr := ""
-	if v.IsLoading() {
-		loadingStr = " [loading...]"
-	}
-	modeStr := v.buildModeStr()
+// copyMapped reads the mapped file of v into memory before it's followed. A copytruncate
+// or rewrite would otherwise change or take away the lines shown, the mapping is shared
+// with the file. Lines the file no longer holds read as zero bytes.
+func (v *Viewer) copyMapped() {
+	v.mu.RLock()
+	m := v.mapped
+	data := make([]byte, len(m.data))
+	v.mu.RUnlock()
 
-	var status string
-	if depth > 1 {
-		status = fmt.Sprintf(" Line %d/%d | Original %d/%d%s | Col %d%s%s | Depth %d | q:quit ",
-			v.topLine+1, lineCount, origLine+1, origTotal, searchInfo, v.leftCol, modeStr, loadingStr, depth)
-	} else {
-		status = fmt.Sprintf(" Line %d/%d%s | Col %d%s%s | Depth %d | q:quit ",
-			v.topLine+1, lineCount, searchInfo, v.leftCol, modeStr, loadingStr, depth)
-	}
+	m.file.ReadAt(data, 0)
 
-	drawStatusText(v.width, v.height, status)
+	// Sources taken before keep reading the mapping, so it's left mapped
+	v.mu.Lock()
+	m.data = data
+	m.copied = true
+	v.mu.Unlock()
+}
 
-	// Draw right-aligned filename
-	if v.filename != "" {
-		filenameDisplay := " " + v.filename + " "
-		startX := v.width - len([]rune(filenameDisplay))
-		if startX > len(status) {
-			for i, char := range filenameDisplay {
-				termbox.SetCell(startX+i, v.height, char, termbox.ColorBlack, termbox.ColorWhite)
+// release unmaps and closes the file of a viewer no one else reads (the file a diff is
+// compared with, or of a closed tab) once it's done loading
+func (v *Viewer) release() {
+	go func() {
+		// The initial load may still be indexing the mapping
+		for v.IsLoading() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		v.placing.Wait()
+		v.mu.Lock()
+		m := v.mapped
+		v.mapped = nil
+		v.mu.Unlock()
+		if m == nil {
+			return
+		}
+		if !m.copied {
+			munmapFile(m.data)
+		}
+		m.file.Close()
+	}()
+}
+
+// close stops following the root viewer v and releases its files once views, the views
+// of a closed tab, are done reading them
+func (v *Viewer) close(views []*Viewer) {
+	v.follow.Store(false)
+	go func() {
+		for _, view := range append(views, v) {
+			for view.IsLoading() {
+				time.Sleep(10 * time.Millisecond)
 			}
 		}
+		// The follower stops when it next wakes up
+		v.following.Lock()
+		defer v.following.Unlock()
+		if f := v.follower; f != nil && f.file != nil && !f.mapped {
+			f.file.Close()
+		}
+		v.mu.RLock()
+		merged := v.merged
+		v.mu.RUnlock()
+		for _, f := range merged {
+			f.file.Close()
+		}
+		v.release()
+	}()
+}
+
+// growMapping returns the first size bytes of the mapped file of v, which has grown to
+// size. The file is only mapped again once it outgrows the room mapped past its end
+// last time, and then with as much room again, so a growing file is mapped a handful of
+// times rather than on every write. Old mappings can't be unmapped, sources taken
+// before may still be reading them. A copied file is read on into the room past its
+// end the same way, fewer bytes are returned if it's shorter than size by then.
+func (v *Viewer) growMapping(size int64) ([]byte, error) {
+	v.mu.RLock()
+	m := v.mapped
+	data, copied := m.data, m.copied
+	v.mu.RUnlock()
+	if !copied {
+		if int64(cap(data)) >= size {
+			return data[:size], nil
+		}
+		return mmapFile(m.file, size, 2*size)
+	}
+
+	// Sources taken before only read up to their own length, the room past it is free
+	if int64(cap(data)) < size {
+		data = append(make([]byte, 0, 2*size), data...)
+	}
+	n, err := m.file.ReadAt(data[len(data):size], int64(len(data)))
+	if err == io.EOF {
+		err = nil
 	}
+	return data[:len(data)+n], err
 }
 
-// getExpandedLineCount returns how many screen rows a line expands to
-func (v *Viewer) getExpandedLineCount(lineIdx int) int {
-	if lineIdx < 0 || lineIdx >= v.LineCount() {
-		return 1
+// appendLines appends lines held in memory (thread-safe). In follow mode a view
+// showing the last line scrolls along with the new lines.
+func (v *Viewer) appendLines(lines []string) {
+	if len(lines) == 0 {
+		return
 	}
-	if v.width <= 0 {
-		return 1 // Safety: avoid division by zero
+	hasANSI := make([]bool, len(lines))
+	for i, line := range lines {
+		hasANSI[i] = lineHasANSI(line)
 	}
 
-	// Build cache key based on current mode, width, and line numbers (affects wrap width)
-	lineNumWidth := v.getLineNumWidth()
-	effectiveWidth := v.width - lineNumWidth
-	cacheKey := fmt.Sprintf("%v:%v:%d", v.wordWrap, v.jsonPretty, effectiveWidth)
-	if v.expandedCacheKey != cacheKey {
-		// Mode or width changed, invalidate cache
-		v.expandedCache = make(map[int]int)
-		v.expandedCacheKey = cacheKey
+	// Check if we're at the bottom before adding lines
+	atBottom := v.follow.Load() && v.topLine >= v.LineCount()-v.height
+
+	v.mu.Lock()
+	v.lines = append(v.lines, lines...)
+	v.hasANSI = append(v.hasANSI, hasANSI...)
+	v.mu.Unlock()
+
+	if atBottom {
+		v.scrollToEnd()
 	}
+	v.notifyChildren()
+}
 
-	// Check cache
-	if v.expandedCache != nil {
-		if count, ok := v.expandedCache[lineIdx]; ok {
-			return count
+// subscribe registers a filtered view to be updated with lines appended to v
+func (v *Viewer) subscribe(child *Viewer) {
+	v.mu.Lock()
+	v.children = append(v.children, child)
+	v.mu.Unlock()
+}
+
+// unsubscribe stops updating a filtered view that left the stack
+func (v *Viewer) unsubscribe() {
+	if v.parent == nil {
+		return
+	}
+	p := v.parent
+	p.mu.Lock()
+	for i, child := range p.children {
+		if child == v {
+			p.children = append(p.children[:i:i], p.children[i+1:]...)
+			break
 		}
-	} else {
-		v.expandedCache = make(map[int]int)
 	}
+	p.mu.Unlock()
+}
 
-	// Calculate expanded count
-	line := v.GetLine(lineIdx)
+// notifyChildren runs lines appended to v through the filters of its live views
+func (v *Viewer) notifyChildren() {
+	v.mu.RLock()
+	children := v.children
+	v.mu.RUnlock()
+	for _, child := range children {
+		child.update()
+	}
+}
 
-	// Get expanded lines (JSON or original)
-	var lines []string
-	if v.jsonPretty && isJSON(line) {
-		lines = formatJSON(line)
-	} else {
-		lines = []string{line}
+// update appends the parent lines added since the last update that pass the filter
+func (v *Viewer) update() {
+	v.updating.Lock()
+	defer v.updating.Unlock()
+
+	// The initial filter pass catches up with the parent when it's done
+	if v.IsLoading() {
+		return
 	}
 
-	var totalRows int
-	if !v.wordWrap {
-		totalRows = len(lines)
-	} else {
-		// Count wrapped rows for each line (using effective width accounting for line numbers)
-		wrapWidth := effectiveWidth
-		if wrapWidth <= 0 {
-			wrapWidth = 1
-		}
-		for _, l := range lines {
-			cells := parseANSI(l)
-			if len(cells) == 0 {
-				totalRows++
-			} else {
-				totalRows += (len(cells) + wrapWidth - 1) / wrapWidth
+	src := v.parent.Snapshot()
+	last := -1
+	if indices := v.OriginIndices(); len(indices) > 0 {
+		last = indices[len(indices)-1]
+	}
+	var indices []int
+	keep := v.baseShows(v.scanned)
+	if v.records != nil {
+		indices = v.updateRecords(src, last, keep)
+	}
+	for i := v.scanned; i < src.Len() && v.records == nil; i++ {
+		if v.match(src.Line(i), src.HasANSI(i)) || keep(i) {
+			// Context before the match that isn't shown yet, then the match
+			for j := max(i-v.before, last+1); j <= i; j++ {
+				indices = append(indices, j)
 			}
+			last = i
+			v.trailing = v.after
+		} else if v.trailing > 0 {
+			indices = append(indices, i)
+			last = i
+			v.trailing--
 		}
 	}
-
-	if totalRows == 0 {
-		totalRows = 1
+	v.scanned = src.Len()
+	if len(indices) == 0 {
+		return
 	}
 
-	// Store in cache
-	v.expandedCache[lineIdx] = totalRows
-	return totalRows
+	// Check if we're at the bottom before adding lines
+	atBottom := v.root().follow.Load() && v.topLine >= v.LineCount()-v.height
+
+	v.mu.Lock()
+	v.originIndices = append(v.originIndices, indices...)
+	v.mu.Unlock()
+
+	if atBottom {
+		v.scrollToEnd()
+	}
+	v.notifyChildren()
+	termbox.Interrupt()
 }
 
-func (v *Viewer) navigateUp() {
-	if v.wordWrap || v.jsonPretty {
-		if v.topLineOffset > 0 {
-			v.topLineOffset--
-		} else if v.topLine > 0 {
-			v.topLine--
-			v.topLineOffset = v.getExpandedLineCount(v.topLine) - 1
+// updateRecords returns the parent lines added since the last update that belong to
+// records passing the filter (or kept by keep). The last record can still grow, so it's
+// matched again each time a line is added to it.
+func (v *Viewer) updateRecords(src lineSource, last int, keep func(i int) bool) []int {
+	var indices []int
+	for i := v.scanned; i < src.Len(); i++ {
+		if v.records.isStart(src.Line(i)) {
+			v.recStart, v.recShown = i, 0
 		}
-	} else {
-		if v.topLine > 0 {
-			v.topLine--
+		text, hasANSI := recordText(src, v.recStart, i+1)
+		if v.match(text, hasANSI) || keep(i) {
+			// The whole record (and context before it) if it wasn't shown yet
+			from := v.recStart + v.recShown
+			if v.recShown == 0 {
+				from = v.recStart - v.before
+			}
+			for j := max(from, last+1); j <= i; j++ {
+				indices = append(indices, j)
+			}
+			last = i
+			v.recShown = i + 1 - v.recStart
+			v.trailing = v.after
+		} else if v.trailing > 0 {
+			indices = append(indices, i)
+			last = i
+			v.trailing--
 		}
 	}
+	return indices
 }
 
-func (v *Viewer) navigateDown() {
-	maxTop := v.LineCount() - 1
-	if maxTop < 0 {
-		maxTop = 0
+// root returns the viewer at the bottom of the filter chain
+func (v *Viewer) root() *Viewer {
+	for v.parent != nil {
+		v = v.parent
 	}
+	return v
+}
 
-	if v.wordWrap || v.jsonPretty {
-		expandedCount := v.getExpandedLineCount(v.topLine)
-		if v.topLineOffset < expandedCount-1 {
-			v.topLineOffset++
-		} else if v.topLine < maxTop {
-			v.topLine++
-			v.topLineOffset = 0
-		}
-	} else {
-		if v.topLine < maxTop {
-			v.topLine++
+// baseShows returns a test for whether the base view of v shows a root line, for the
+// root lines from line from on (always false without a base). The base view is updated
+// before v, since it subscribed to the root first. Lines must be tested in order.
+func (v *Viewer) baseShows(from int) func(i int) bool {
+	if v.base == nil {
+		return func(int) bool { return false }
+	}
+	shown := rootIndicesFrom(v.base.Snapshot(), from)
+	return func(i int) bool {
+		for len(shown) > 0 && shown[0] < i {
+			shown = shown[1:]
 		}
+		return len(shown) > 0 && shown[0] == i
 	}
 }
 
-func (v *Viewer) navigateLeft(amount int) {
-	newValue := v.leftCol - amount
-	if newValue < 0 {
-		newValue = 0
+// scrollToEnd scrolls so the last line is at the bottom of the screen (used while following)
+func (v *Viewer) scrollToEnd() {
+	lineCount := v.LineCount()
+	v.mu.Lock()
+	v.topLine = lineCount - v.height
+	if v.topLine < 0 {
+		v.topLine = 0
 	}
-	v.leftCol = newValue
+	v.mu.Unlock()
 }
 
-func (v *Viewer) navigateRight(amount int) {
-	v.leftCol += amount
+// setNotice leaves a message for the status bar from a background goroutine
+func (v *Viewer) setNotice(msg string) {
+	v.mu.Lock()
+	v.notice = msg
+	v.mu.Unlock()
+	termbox.Interrupt()
 }
 
-func (v *Viewer) pageDown() {
-	if v.wordWrap || v.jsonPretty {
-		// Move by screen height rows
-		for i := 0; i < v.height; i++ {
-			v.navigateDown()
-		}
-	} else {
-		v.topLine += v.height
-		// Allow scrolling until last line is at top
-		maxTop := v.LineCount() - 1
-		if maxTop < 0 {
-			maxTop = 0
-		}
-		if v.topLine > maxTop {
-			v.topLine = maxTop
-		}
-	}
+// TakeNotice returns and clears the pending background message (thread-safe)
+func (v *Viewer) TakeNotice() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	msg := v.notice
+	v.notice = ""
+	return msg
 }
 
-func (v *Viewer) pageUp() {
-	if v.wordWrap || v.jsonPretty {
-		// Move by screen height rows
-		for i := 0; i < v.height; i++ {
-			v.navigateUp()
-		}
-	} else {
-		v.topLine -= v.height
-		if v.topLine < 0 {
-			v.topLine = 0
-		}
-	}
-}
+// NewViewerFromStdin creates a Viewer that reads from stdin
+func NewViewerFromStdin(opts viewerOptions) *Viewer {
+	v := newViewer("<stdin>", opts)
+	v.stream = true
 
-func (v *Viewer) goToStart() {
-	v.topLine = 0
-	v.topLineOffset = 0
-}
+	// Load stdin in background
+	go func() {
+		loadFromReader(v, os.Stdin)
+	}()
 
-func (v *Viewer) goToEnd() {
-	v.topLineOffset = 0
-	// Go to last line at top
-	v.topLine = v.LineCount() - 1
-	if v.topLine < 0 {
-		v.topLine = 0
-	}
+	return v
 }
 
-func (v *Viewer) resize(width, height int) {
-	v.width = width
-	v.height = height - 1 // Reserve one line for status bar
-}
+// loadFromReader loads lines from an io.Reader into a Viewer. Lines are also flushed to
+// the viewer whenever the reader runs dry, so piped streams (kubectl logs -f) show up
+// as they arrive instead of once a batch is full.
+func loadFromReader(v *Viewer, r io.Reader) {
+	br := bufio.NewReaderSize(r, 64*1024)
 
-// promptForInput shows a prompt at the bottom line and collects user input
-func (v *Viewer) promptForInput(prompt string) (string, bool) {
-	input := ""
+	const batchSize = 10000
+	batch := make([]string, 0, batchSize)
+	var lastInterrupt time.Time
+	var redrawPending atomic.Bool
 
 	for {
-		statusY := v.height
-		line := prompt + input
-
-		for i := 0; i < v.width; i++ {
-			termbox.SetCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		line, err := br.ReadString('\n')
+		if line != "" {
+			batch = append(batch, strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
 		}
-		for i, char := range line {
-			if i >= v.width {
-				break
+
+		// Flush when the batch is full or the next read would wait for more input
+		if len(batch) >= batchSize || (len(batch) > 0 && (err != nil || !hasBufferedLine(br))) {
+			v.appendLines(batch)
+			batch = make([]string, 0, batchSize)
+
+			// Redraw at most every 100ms, a trailing redraw picks up lines that
+			// arrive in between so a quiet stream still shows its last lines
+			if time.Since(lastInterrupt) >= 100*time.Millisecond {
+				lastInterrupt = time.Now()
+				termbox.Interrupt()
+			} else if redrawPending.CompareAndSwap(false, true) {
+				time.AfterFunc(100*time.Millisecond, func() {
+					redrawPending.Store(false)
+					termbox.Interrupt()
+				})
 			}
-			termbox.SetCell(i, statusY, char, termbox.ColorBlack, termbox.ColorWhite)
 		}
-		cursorPos := len([]rune(line))
-		if cursorPos < v.width {
-			termbox.SetCursor(cursorPos, statusY)
+		if err != nil {
+			break
 		}
-		termbox.Flush()
+	}
 
-		ev := termbox.PollEvent()
-		switch ev.Type {
-		case termbox.EventKey:
-			if ev.Key == termbox.KeyEnter {
-				termbox.HideCursor()
-				return input, true
-			} else if ev.Key == termbox.KeyEsc {
-				termbox.HideCursor()
-				return "", false
-			} else if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
-				if len(input) > 0 {
-					runes := []rune(input)
-					input = string(runes[:len(runes)-1])
-				}
-			} else if ev.Ch != 0 {
-				input += string(ev.Ch)
-			} else if ev.Key == termbox.KeySpace {
-				input += " "
-			}
-		case termbox.EventResize:
-			termbox.Sync()
-			v.resize(ev.Width, ev.Height)
-			v.draw()
-		}
+	v.mu.Lock()
+	v.loading = false
+	v.mu.Unlock()
+	termbox.Interrupt()
+}
+
+// hasBufferedLine reports whether a complete line can be read without waiting for input
+func hasBufferedLine(br *bufio.Reader) bool {
+	buffered, _ := br.Peek(br.Buffered())
+	return bytes.IndexByte(buffered, '\n') >= 0
+}
+
+// NewViewerFromLines creates a Viewer from an existing slice of lines
+func NewViewerFromLines(lines []string) *Viewer {
+	hasANSI := make([]bool, len(lines))
+	for i, line := range lines {
+		hasANSI[i] = lineHasANSI(line)
+	}
+	return &Viewer{
+		lines:    lines,
+		hasANSI:  hasANSI,
+		loading:  false,
+		filename: "", // empty for test viewers
+		topLine:  0,
+		leftCol:  0,
 	}
 }
 
-// promptWithModifiers prompts for input with regex (Ctrl+R), case (Ctrl+I) toggles, and history
-// Returns: input string, isRegex flag, ignoreCase flag, ok
-func (a *App) promptWithModifiers(prompt string) (string, bool, bool, bool) {
-	v := a.stack.Current()
-	a.history.Reset()
-	input := ""
-	isRegex := false
-	ignoreCase := false
+// lineSource is a read-only view of a viewer's lines that worker goroutines can scan
+// without locking. Viewers only ever append lines, so a source stays valid while
+// loading or filtering continues in the background.
+type lineSource interface {
+	Len() int
+	Line(i int) string
+	HasANSI(i int) bool
+}
 
-	for {
-		statusY := v.height
-		indicators := ""
-		if isRegex {
-			indicators += "[regex]"
-		}
-		if ignoreCase {
-			if indicators != "" {
-				indicators += " "
-			}
-			indicators += "[nocase]"
-		}
-		if indicators != "" {
-			indicators += " "
-		}
-		line := prompt + indicators + input
+// sliceSource serves lines held in memory
+type sliceSource struct {
+	lines   []string
+	hasANSI []bool
+}
 
-		for i := 0; i < v.width; i++ {
-			termbox.SetCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
-		}
-		for i, char := range line {
-			if i >= v.width {
-				break
-			}
-			termbox.SetCell(i, statusY, char, termbox.ColorBlack, termbox.ColorWhite)
-		}
-		cursorPos := len([]rune(line))
-		if cursorPos < v.width {
-			termbox.SetCursor(cursorPos, statusY)
-		}
-		termbox.Flush()
+func (s *sliceSource) Len() int           { return len(s.lines) }
+func (s *sliceSource) Line(i int) string  { return s.lines[i] }
+func (s *sliceSource) HasANSI(i int) bool { return i < len(s.hasANSI) && s.hasANSI[i] }
+
+// mappedSource serves lines straight out of a memory mapping (or the copy of a followed
+// file). Mappings are never unmapped while the viewer is open, since sources taken before
+// a followed file was copied may still be scanned.
+type mappedSource struct {
+	data    []byte
+	offsets []int64
+	tailEnd int64
+	hasANSI []bool
+}
 
-		ev := termbox.PollEvent()
-		switch ev.Type {
-		case termbox.EventKey:
-			if ev.Key == termbox.KeyEnter {
-				termbox.HideCursor()
-				if input != "" {
-					a.history.AddWithModifiers(input, isRegex, ignoreCase)
-				}
-				return input, isRegex, ignoreCase, true
-			} else if ev.Key == termbox.KeyEsc {
-				termbox.HideCursor()
-				return "", false, false, false
-			} else if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
-				if len(input) > 0 {
-					runes := []rune(input)
-					input = string(runes[:len(runes)-1])
-				}
-			} else if ev.Key == termbox.KeyArrowUp {
-				input, isRegex, ignoreCase = a.history.UpWithModifiers(input, isRegex, ignoreCase)
-			} else if ev.Key == termbox.KeyArrowDown {
-				input, isRegex, ignoreCase = a.history.DownWithModifiers(input, isRegex, ignoreCase)
-			} else if ev.Key == termbox.KeyCtrlR {
-				isRegex = !isRegex
-			} else if ev.Key == termbox.KeyCtrlI {
-				ignoreCase = !ignoreCase
-			} else if ev.Ch != 0 {
-				input += string(ev.Ch)
-			} else if ev.Key == termbox.KeySpace {
-				input += " "
-			}
-		case termbox.EventResize:
-			termbox.Sync()
-			v.resize(ev.Width, ev.Height)
-			v.draw()
-		}
+func (s *mappedSource) Len() int {
+	n := len(s.offsets) - 1
+	if s.tailEnd > s.offsets[n] {
+		n++
 	}
+	return n
 }
 
-// NewViewerStack creates a new ViewerStack with the initial viewer
-func NewViewerStack(initial *Viewer) *ViewerStack {
-	return &ViewerStack{
-		viewers: []*Viewer{initial},
+// lineBytes returns line i without its line ending
+func (s *mappedSource) lineBytes(i int) []byte {
+	end := s.tailEnd
+	if i+1 < len(s.offsets) {
+		end = s.offsets[i+1]
+	}
+	b := s.data[s.offsets[i]:end]
+	if n := len(b); n > 0 && b[n-1] == '\n' {
+		b = b[:n-1]
 	}
+	if n := len(b); n > 0 && b[n-1] == '\r' {
+		b = b[:n-1]
+	}
+	return b
 }
 
-// Current returns the current (top) viewer
-func (s *ViewerStack) Current() *Viewer {
-	return s.viewers[len(s.viewers)-1]
+// Line copies line i out of the mapping
+func (s *mappedSource) Line(i int) string {
+	return string(s.lineBytes(i))
 }
 
-// Push adds a new viewer to the stack
-func (s *ViewerStack) Push(v *Viewer) {
-	s.viewers = append(s.viewers, v)
+func (s *mappedSource) HasANSI(i int) bool {
+	if i < len(s.hasANSI) {
+		return s.hasANSI[i]
+	}
+	// Unterminated tail line isn't indexed yet
+	return bytes.IndexByte(s.lineBytes(i), 0x1b) >= 0
 }
 
-// Pop removes and returns the top viewer, returns false if only one viewer remains
-func (s *ViewerStack) Pop() bool {
-	if len(s.viewers) <= 1 {
-		return false
+// recoverMemoryFault is deferred around indexing a mapping to swallow the fault raised
+// when its file was truncated (see debug.SetPanicOnFault). Other panics are re-raised.
+func recoverMemoryFault() {
+	if r := recover(); r != nil {
+		if _, ok := r.(interface{ Addr() uintptr }); !ok {
+			panic(r)
+		}
 	}
-	s.viewers = s.viewers[:len(s.viewers)-1]
-	return true
 }
 
-// Reset removes all viewers except the first one, returns false if already at first
-func (s *ViewerStack) Reset() bool {
-	if len(s.viewers) <= 1 {
-		return false
+// chainSource serves the lines of first followed by the lines of rest
+type chainSource struct {
+	first lineSource
+	rest  lineSource
+}
+
+func (s *chainSource) Len() int { return s.first.Len() + s.rest.Len() }
+
+func (s *chainSource) Line(i int) string {
+	if n := s.first.Len(); i >= n {
+		return s.rest.Line(i - n)
 	}
-	s.viewers = s.viewers[:1]
-	return true
+	return s.first.Line(i)
 }
 
-// NewApp creates a new App with the given viewer
-func NewApp(viewer *Viewer) *App {
-	return &App{
-		stack:   NewViewerStack(viewer),
-		search:  &SearchState{},
-		history: NewHistory("/tmp/sieve_history"),
+func (s *chainSource) HasANSI(i int) bool {
+	if n := s.first.Len(); i >= n {
+		return s.rest.HasANSI(i - n)
 	}
+	return s.first.HasANSI(i)
 }
 
-// ShowTempMessage displays a message for 3 seconds
-func (a *App) ShowTempMessage(msg string) {
-	a.statusMessage = msg
-	a.messageExpiry = time.Now().Add(3 * time.Second)
-	go func() {
-		time.Sleep(3 * time.Second)
-		termbox.Interrupt()
-	}()
+// indexedSource serves the lines of a filtered view by looking them up in its parent
+type indexedSource struct {
+	parent  lineSource
+	indices []int
 }
 
-// copyToClipboard copies text to system clipboard
-func copyToClipboard(text string) error {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("pbcopy")
-	case "linux":
-		cmd = exec.Command("xclip", "-selection", "clipboard")
+func (s *indexedSource) Len() int           { return len(s.indices) }
+func (s *indexedSource) Line(i int) string  { return s.parent.Line(s.indices[i]) }
+func (s *indexedSource) HasANSI(i int) bool { return s.parent.HasANSI(s.indices[i]) }
+
+// Snapshot returns a read-only view of the lines loaded so far (thread-safe)
+func (v *Viewer) Snapshot() lineSource {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	switch {
+	case v.parent != nil:
+		return &indexedSource{parent: v.parent.Snapshot(), indices: v.originIndices}
+	case v.mapped != nil:
+		m := v.mapped
+		src := &mappedSource{data: m.data, offsets: m.offsets, tailEnd: m.tailEnd, hasANSI: m.hasANSI}
+		if len(v.lines) == 0 {
+			return src
+		}
+		// Lines read after the followed file was rotated or truncated are held in memory
+		return &chainSource{first: src, rest: &sliceSource{lines: v.lines, hasANSI: v.hasANSI}}
 	default:
-		return fmt.Errorf("clipboard not supported on %s", runtime.GOOS)
+		return &sliceSource{lines: v.lines, hasANSI: v.hasANSI}
 	}
-	cmd.Stdin = strings.NewReader(text)
-	return cmd.Run()
 }
 
-// EnterVisualMode starts visual line selection
-func (a *App) EnterVisualMode() {
-	current := a.stack.Current()
-	a.visualMode = true
-	a.visualStart = current.topLine
-	a.visualStartOffset = current.topLineOffset
-	a.visualCursor = current.topLine
-	a.visualCursorOffset = current.topLineOffset
+// LineCount returns the number of lines (thread-safe)
+func (v *Viewer) LineCount() int {
+	return v.Snapshot().Len()
 }
 
-// ExitVisualMode exits visual mode without action
-func (a *App) ExitVisualMode() {
-	a.visualMode = false
-	a.visualStart = 0
-	a.visualStartOffset = 0
-	a.visualCursor = 0
-	a.visualCursorOffset = 0
+// GetLine returns a line at index (thread-safe), or empty string if out of bounds
+func (v *Viewer) GetLine(idx int) string {
+	src := v.Snapshot()
+	if idx < 0 || idx >= src.Len() {
+		return ""
+	}
+	return src.Line(idx)
 }
 
-// VisualCursorDown moves cursor down in visual mode, scrolling if needed
-func (a *App) VisualCursorDown() {
-	current := a.stack.Current()
-	lineCount := current.LineCount()
+// OriginIndices returns the parent indices computed so far (thread-safe)
+func (v *Viewer) OriginIndices() []int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.originIndices
+}
 
-	if current.wordWrap || current.jsonPretty {
-		// Row-by-row movement in wrap/json mode
-		expandedCount := current.getExpandedLineCount(a.visualCursor)
-		if a.visualCursorOffset < expandedCount-1 {
-			a.visualCursorOffset++
-		} else if a.visualCursor < lineCount-1 {
-			a.visualCursor++
-			a.visualCursorOffset = 0
-		}
-		// Scroll if cursor goes below visible area
-		a.visualScrollIfNeeded()
-	} else {
-		if a.visualCursor < lineCount-1 {
-			a.visualCursor++
-			// Scroll if cursor goes below visible area
-			if a.visualCursor >= current.topLine+current.height {
-				current.topLine++
-			}
-		}
-	}
+// IsLoading returns true if still loading (thread-safe)
+func (v *Viewer) IsLoading() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.loading
 }
 
-// VisualCursorUp moves cursor up in visual mode, scrolling if needed
-func (a *App) VisualCursorUp() {
-	current := a.stack.Current()
+func (v *Viewer) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 
-	if current.wordWrap || current.jsonPretty {
-		// Row-by-row movement in wrap/json mode
-		if a.visualCursorOffset > 0 {
-			a.visualCursorOffset--
-		} else if a.visualCursor > 0 {
-			a.visualCursor--
-			a.visualCursorOffset = current.getExpandedLineCount(a.visualCursor) - 1
+	// Draw visible lines
+	lineCount := v.LineCount()
+	for screenY := 0; screenY < v.height; screenY++ {
+		lineIndex := v.topLine + screenY
+
+		// Check if we've run out of lines
+		if lineIndex >= lineCount {
+			break
 		}
-		// Scroll if cursor goes above visible area
-		a.visualScrollIfNeeded()
-	} else {
-		if a.visualCursor > 0 {
-			a.visualCursor--
-			// Scroll if cursor goes above visible area
-			if a.visualCursor < current.topLine {
-				current.topLine--
+
+		line := v.GetLine(lineIndex)
+		runes := []rune(line)
+
+		// Draw each character in the line
+		screenX := 0
+		for i, char := range runes {
+			// Skip characters before the horizontal scroll offset
+			if i < v.leftCol {
+				continue
+			}
+
+			// Stop if we've reached the edge of the screen
+			if screenX >= v.width {
+				break
 			}
+
+			v.setCell(screenX, screenY, char, termbox.ColorDefault, termbox.ColorDefault)
+			screenX++
 		}
 	}
+
+	// Draw status bar at the bottom
+	v.drawStatusBar()
+
+	termbox.Flush()
 }
 
-// visualScrollIfNeeded scrolls the view to keep visual cursor visible (for wrap/json mode)
-// visualCursorScreenRow calculates the screen row of the visual cursor relative to topLine
-func (a *App) visualCursorScreenRow(current *Viewer) int {
-	if a.visualCursor > current.topLine {
-		row := 0
-		for i := current.topLine; i < a.visualCursor; i++ {
-			row += current.getExpandedLineCount(i)
+// drawStatusText clears the status line and draws text (used by multiple status bar functions)
+func (v *Viewer) drawStatusText(text string) {
+	for i := 0; i < v.width; i++ {
+		v.setCell(i, v.height, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	}
+	for i, char := range text {
+		if i >= v.width {
+			break
 		}
-		return row - current.topLineOffset + a.visualCursorOffset
-	} else if a.visualCursor == current.topLine {
-		return a.visualCursorOffset - current.topLineOffset
+		v.setCell(i, v.height, char, termbox.ColorBlack, termbox.ColorWhite)
 	}
-	return -1 // Cursor is above topLine
 }
 
-func (a *App) visualScrollIfNeeded() {
-	current := a.stack.Current()
-
-	// Scroll down if cursor below visible area
-	for a.visualCursorScreenRow(current) >= current.height {
-		current.navigateDown()
+// buildModeStr returns the mode indicators string
+func (v *Viewer) buildModeStr() string {
+	modeStr := ""
+	if v.follow.Load() {
+		modeStr += " [follow]"
 	}
-
-	// Scroll up if cursor above visible area
-	for a.visualCursorScreenRow(current) < 0 {
-		current.navigateUp()
+	if v.wordWrap {
+		modeStr += " [wrap]"
+	}
+	if v.jsonPretty {
+		modeStr += " [json]"
+	}
+	if v.showLineNumbers {
+		modeStr += " [ln]"
+	}
+	if v.stickyLeft > 0 {
+		modeStr += fmt.Sprintf(" [K:%d]", v.stickyLeft)
+	}
+	if v.root().records != nil {
+		modeStr += " [records]"
 	}
+	return modeStr
 }
 
-// VisualPageDown moves cursor down by a page in visual mode
-func (a *App) VisualPageDown() {
-	current := a.stack.Current()
-	lineCount := current.LineCount()
+func (v *Viewer) drawStatusBar() {
+	v.drawStatusBarWithDepth(1, v.topLine, v.LineCount())
+}
 
-	if current.wordWrap || current.jsonPretty {
-		// Move by screen height rows
-		for i := 0; i < current.height; i++ {
-			a.VisualCursorDown()
-		}
+func (v *Viewer) drawStatusBarWithDepth(depth int, origLine int, origTotal int) {
+	lineCount := v.LineCount()
+	loadingStr := ""
+	if v.IsLoading() {
+		loadingStr = " [loading...]"
+	}
+	modeStr := v.buildModeStr()
+
+	var status string
+	if depth > 1 {
+		status = fmt.Sprintf(" Line %d/%d | Original %d/%d | Col %d%s%s | Depth %d | q:quit ",
+			v.topLine+1, lineCount, origLine+1, origTotal, v.leftCol, modeStr, loadingStr, depth)
 	} else {
-		a.visualCursor += current.height
-		if a.visualCursor >= lineCount {
-			a.visualCursor = lineCount - 1
-		}
-		// Scroll to keep cursor visible
-		if a.visualCursor >= current.topLine+current.height {
-			current.topLine = a.visualCursor - current.height + 1
-			if current.topLine < 0 {
-				current.topLine = 0
-			}
-		}
+		status = fmt.Sprintf(" Line %d/%d | Col %d%s%s | Depth %d | q:quit ",
+			v.topLine+1, lineCount, v.leftCol, modeStr, loadingStr, depth)
 	}
-}
 
-// VisualPageUp moves cursor up by a page in visual mode
-func (a *App) VisualPageUp() {
-	current := a.stack.Current()
+	v.drawStatusText(status)
 
-	if current.wordWrap || current.jsonPretty {
-		// Move by screen height rows
-		for i := 0; i < current.height; i++ {
-			a.VisualCursorUp()
-		}
-	} else {
-		a.visualCursor -= current.height
-		if a.visualCursor < 0 {
-			a.visualCursor = 0
-		}
-		// Scroll to keep cursor visible
-		if a.visualCursor < current.topLine {
-			current.topLine = a.visualCursor
+	// Draw right-aligned filename
+	if v.filename != "" {
+		filenameDisplay := " " + v.filename + " "
+		startX := v.width - len([]rune(filenameDisplay))
+		if startX > len(status) {
+			for i, char := range filenameDisplay {
+				v.setCell(startX+i, v.height, char, termbox.ColorBlack, termbox.ColorWhite)
+			}
 		}
 	}
 }
 
-// VisualGoToStart moves cursor to start of file in visual mode
-func (a *App) VisualGoToStart() {
-	current := a.stack.Current()
-	a.visualCursor = 0
-	a.visualCursorOffset = 0
-	current.topLine = 0
-	current.topLineOffset = 0
+// showMessage displays a message on the status bar
+func (v *Viewer) showMessage(msg string) {
+	v.drawStatusText(msg)
+	termbox.Flush()
 }
 
-// VisualGoToEnd moves cursor to end of file in visual mode
-func (a *App) VisualGoToEnd() {
-	current := a.stack.Current()
-	lineCount := current.LineCount()
-	a.visualCursor = lineCount - 1
-	if current.wordWrap || current.jsonPretty {
-		a.visualCursorOffset = current.getExpandedLineCount(a.visualCursor) - 1
-	} else {
-		a.visualCursorOffset = 0
-	}
-	// Scroll to show cursor
-	a.visualScrollIfNeeded()
+// drawVisualStatusBar draws the status bar in visual mode
+func (a *App) drawVisualStatusBar(v *Viewer, status string) {
+	v.drawStatusText(status)
 }
 
-// YankVisualSelection copies selected lines to clipboard
-func (a *App) YankVisualSelection() {
-	if !a.visualMode {
-		return
+// drawStatusBarWithSearch draws the status bar including search info, and the tabs if
+// showTabs is set
+func (a *App) drawStatusBarWithSearch(v *Viewer, depth int, origLine int, origTotal int, searchInfo string, showTabs bool) {
+	lineCount := v.LineCount()
+	loadingStr := ""
+	if v.IsLoading() {
+		loadingStr = " [loading...]"
 	}
+	modeStr := v.buildModeStr()
 
-	current := a.stack.Current()
-
-	var lines []string
-	var rowCount int
+	var status string
+	if depth > 1 {
+		status = fmt.Sprintf(" Line %d/%d | Original %d/%d%s | Col %d%s%s | Depth %d | q:quit ",
+			v.topLine+1, lineCount, origLine+1, origTotal, searchInfo, v.leftCol, modeStr, loadingStr, depth)
+	} else {
+		status = fmt.Sprintf(" Line %d/%d%s | Col %d%s%s | Depth %d | q:quit ",
+			v.topLine+1, lineCount, searchInfo, v.leftCol, modeStr, loadingStr, depth)
+	}
 
-	if current.wordWrap || current.jsonPretty {
-		// Row-by-row yank in wrap/JSON mode
-		startLine := a.visualStart
-		startOff := a.visualStartOffset
-		endLine := a.visualCursor
-		endOff := a.visualCursorOffset
+	v.drawStatusText(status)
 
-		// Ensure start <= end
-		if startLine > endLine || (startLine == endLine && startOff > endOff) {
-			startLine, endLine = endLine, startLine
-			startOff, endOff = endOff, startOff
+	// Draw right-aligned tab bar, or filename with one tab
+	if showTabs && len(a.tabs) > 1 {
+		a.drawTabBar(v, status)
+	} else if v.filename != "" {
+		filenameDisplay := " " + v.filename + " "
+		startX := v.width - len([]rune(filenameDisplay))
+		if startX > len(status) {
+			for i, char := range filenameDisplay {
+				v.setCell(startX+i, v.height, char, termbox.ColorBlack, termbox.ColorWhite)
+			}
 		}
+	}
+}
 
-		wrapWidth := current.width - current.getLineNumWidth()
-		if wrapWidth <= 0 {
-			wrapWidth = current.width
-		}
+// getExpandedLineCount returns how many screen rows a line expands to
+func (v *Viewer) getExpandedLineCount(lineIdx int) int {
+	if lineIdx < 0 || lineIdx >= v.LineCount() {
+		return 1
+	}
+	if v.width <= 0 {
+		return 1 // Safety: avoid division by zero
+	}
 
-		// Iterate through lines and collect selected rows
-		for lineIdx := startLine; lineIdx <= endLine; lineIdx++ {
-			line := current.GetLine(lineIdx)
+	// Build cache key based on current mode, width, and line numbers (affects wrap width)
+	lineNumWidth := v.getLineNumWidth()
+	effectiveWidth := v.width - lineNumWidth
+	cacheKey := fmt.Sprintf("%v:%v:%d", v.wordWrap, v.jsonPretty, effectiveWidth)
+	if v.expandedCacheKey != cacheKey {
+		// Mode or width changed, invalidate cache
+		v.expandedCache = make(map[int]int)
+		v.expandedCacheKey = cacheKey
+	}
 
-			// Expand the line (JSON or wrap)
-			var expandedRows []string
-			if current.jsonPretty && isJSON(line) {
-				expandedRows = formatJSON(line)
-			} else {
-				expandedRows = []string{line}
-			}
+	// Check cache
+	if v.expandedCache != nil {
+		if count, ok := v.expandedCache[lineIdx]; ok {
+			return count
+		}
+	} else {
+		v.expandedCache = make(map[int]int)
+	}
 
-			// If word wrap is enabled, further split each expanded row
-			var allRows []string
-			if current.wordWrap {
-				for _, row := range expandedRows {
-					cells := parseANSI(row)
-					if len(cells) == 0 {
-						allRows = append(allRows, "")
-					} else {
-						// Split into wrapped rows
-						for i := 0; i < len(cells); i += wrapWidth {
-							end := i + wrapWidth
-							if end > len(cells) {
-								end = len(cells)
-							}
-							var rowChars []rune
-							for j := i; j < end; j++ {
-								rowChars = append(rowChars, cells[j].char)
-							}
-							allRows = append(allRows, string(rowChars))
-						}
-					}
-				}
+	// Calculate expanded count
+	line := v.GetLine(lineIdx)
+
+	// Get expanded lines (JSON or original)
+	var lines []string
+	if v.jsonPretty && isJSON(line) {
+		lines = formatJSON(line)
+	} else {
+		lines = []string{line}
+	}
+
+	var totalRows int
+	if !v.wordWrap {
+		totalRows = len(lines)
+	} else {
+		// Count wrapped rows for each line (using effective width accounting for line numbers)
+		wrapWidth := effectiveWidth
+		if wrapWidth <= 0 {
+			wrapWidth = 1
+		}
+		for _, l := range lines {
+			cells := parseANSI(l)
+			if len(cells) == 0 {
+				totalRows++
 			} else {
-				// JSON mode without wrap - each JSON line is a row
-				for _, row := range expandedRows {
-					allRows = append(allRows, stripANSI(row))
-				}
+				totalRows += (len(cells) + wrapWidth - 1) / wrapWidth
 			}
+		}
+	}
 
-			// Determine which rows to include from this line
-			rowStart := 0
-			rowEnd := len(allRows) - 1
+	if totalRows == 0 {
+		totalRows = 1
+	}
 
-			if lineIdx == startLine {
-				rowStart = startOff
-			}
-			if lineIdx == endLine {
-				rowEnd = endOff
-			}
+	// Store in cache
+	v.expandedCache[lineIdx] = totalRows
+	return totalRows
+}
 
-			// Collect the selected rows
-			for rowIdx := rowStart; rowIdx <= rowEnd && rowIdx < len(allRows); rowIdx++ {
-				lines = append(lines, allRows[rowIdx])
-				rowCount++
-			}
+func (v *Viewer) navigateUp() {
+	if v.wordWrap || v.jsonPretty {
+		if v.topLineOffset > 0 {
+			v.topLineOffset--
+		} else if v.topLine > 0 {
+			v.topLine--
+			v.topLineOffset = v.getExpandedLineCount(v.topLine) - 1
 		}
 	} else {
-		// Normal mode - yank entire logical lines
-		startLine := a.visualStart
-		endLine := a.visualCursor
-
-		if startLine > endLine {
-			startLine, endLine = endLine, startLine
-		}
-
-		for i := startLine; i <= endLine; i++ {
-			lines = append(lines, stripANSI(current.GetLine(i)))
+		if v.topLine > 0 {
+			v.topLine--
 		}
-		rowCount = len(lines)
 	}
+}
 
-	text := strings.Join(lines, "\n")
-	err := copyToClipboard(text)
-
-	a.visualMode = false
-	a.visualStart = 0
-	a.visualStartOffset = 0
-	a.visualCursor = 0
-	a.visualCursorOffset = 0
+func (v *Viewer) navigateDown() {
+	maxTop := v.LineCount() - 1
+	if maxTop < 0 {
+		maxTop = 0
+	}
 
-	if err != nil {
-		a.ShowTempMessage("Clipboard error: " + err.Error())
+	if v.wordWrap || v.jsonPretty {
+		expandedCount := v.getExpandedLineCount(v.topLine)
+		if v.topLineOffset < expandedCount-1 {
+			v.topLineOffset++
+		} else if v.topLine < maxTop {
+			v.topLine++
+			v.topLineOffset = 0
+		}
 	} else {
-		a.ShowTempMessage(fmt.Sprintf("Yanked %d row(s)", rowCount))
+		if v.topLine < maxTop {
+			v.topLine++
+		}
 	}
 }
 
-// pythonToGoFormat converts Python datetime format to Go time format
-func pythonToGoFormat(pyFormat string) string {
-	replacements := []struct{ py, go_ string }{
-		{"%Y", "2006"},
-		{"%y", "06"},
-		{"%m", "01"},
-		{"%-d", "2"},  // day without zero padding
-		{"%d", "02"},
-		{"%H", "15"},
-		{"%I", "03"},
-		{"%M", "04"},
-		{"%S", "05"},
-		{"%f", "000000"},
-		{"%p", "PM"},
-		{"%z", "-0700"},
-		{"%Z", "MST"},
-		{"%j", "002"},
-		{"%a", "Mon"},
-		{"%A", "Monday"},
-		{"%b", "Jan"},
-		{"%B", "January"},
-		{"%_d", "_2"}, // space-padded day (for syslog)
-	}
-	result := pyFormat
-	for _, r := range replacements {
-		result = strings.ReplaceAll(result, r.py, r.go_)
+func (v *Viewer) navigateLeft(amount int) {
+	newValue := v.leftCol - amount
+	if newValue < 0 {
+		newValue = 0
 	}
-	return result
+	v.leftCol = newValue
 }
 
-// Common timestamp formats to try for auto-detection
-var commonTimestampFormats = []string{
-	// More specific formats first (with microseconds/milliseconds)
-	"%Y-%m-%d %H:%M:%S.%f", // 2026-01-06 15:48:10.192158
-	"%Y-%m-%dT%H:%M:%S.%f", // 2026-01-06T15:48:10.192158
-	// Standard formats
-	"%Y-%m-%d %H:%M:%S",
-	"%Y-%m-%dT%H:%M:%S",
-	"%Y/%m/%d %H:%M:%S",
-	"%d/%m/%Y %H:%M:%S",
-	"%m/%d/%Y %H:%M:%S",
-	"%H:%M:%S",
-	"%Y%m%d%H%M%S",
-	"[%Y-%m-%d %H:%M:%S]",
-	"%d-%b-%Y %H:%M:%S",
-	"%b %_d %H:%M:%S", // syslog: Jan  4 00:00:01 (space-padded day)
-	"%b %d %H:%M:%S",  // syslog variant with zero-padded day
+func (v *Viewer) navigateRight(amount int) {
+	v.leftCol += amount
 }
 
-// detectTimestampFormat tries to detect timestamp format from a line
-func detectTimestampFormat(line string) string {
-	for _, pyFmt := range commonTimestampFormats {
-		goFmt := pythonToGoFormat(pyFmt)
-		// Try to find a matching timestamp in the line
-		// We'll try parsing substrings of appropriate length
-		fmtLen := len(goFmt)
-		for i := 0; i <= len(line)-fmtLen && i < 50; i++ {
-			substr := line[i : i+fmtLen]
-			_, err := time.Parse(goFmt, substr)
-			if err == nil {
-				return pyFmt
-			}
+func (v *Viewer) pageDown() {
+	if v.wordWrap || v.jsonPretty {
+		// Move by screen height rows
+		for i := 0; i < v.height; i++ {
+			v.navigateDown()
+		}
+	} else {
+		v.topLine += v.height
+		// Allow scrolling until last line is at top
+		maxTop := v.LineCount() - 1
+		if maxTop < 0 {
+			maxTop = 0
+		}
+		if v.topLine > maxTop {
+			v.topLine = maxTop
 		}
 	}
-	return ""
 }
 
-// extractTimestamp extracts and parses timestamp from a line using the given format
-func extractTimestamp(line, pyFormat string) (time.Time, bool) {
-	goFmt := pythonToGoFormat(pyFormat)
-	fmtLen := len(goFmt)
-	
-	for i := 0; i <= len(line)-fmtLen && i < 100; i++ {
-		substr := line[i : i+fmtLen]
-		t, err := time.Parse(goFmt, substr)
-		if err == nil {
-			return t, true
+func (v *Viewer) pageUp() {
+	if v.wordWrap || v.jsonPretty {
+		// Move by screen height rows
+		for i := 0; i < v.height; i++ {
+			v.navigateUp()
+		}
+	} else {
+		v.topLine -= v.height
+		if v.topLine < 0 {
+			v.topLine = 0
 		}
 	}
-	return time.Time{}, false
 }
 
-// HandleSetTimestampFormat prompts for Python datetime format string
-func (a *App) HandleSetTimestampFormat() {
-	current := a.stack.Current()
-	input, ok := current.promptForInput("t (timestamp format): ")
-	if !ok {
-		return
-	}
+func (v *Viewer) goToStart() {
+	v.topLine = 0
+	v.topLineOffset = 0
+}
+
+func (v *Viewer) goToEnd() {
+	v.topLineOffset = 0
+	// Go to last line at top
+	v.topLine = v.LineCount() - 1
+	if v.topLine < 0 {
+		v.topLine = 0
+	}
+}
+
+func (v *Viewer) resize(width, height int) {
+	v.width = width
+	v.height = height - 1 // Reserve one line for status bar
+}
+
+// place puts the view in a part of the screen (a pane) starting at x, y
+func (v *Viewer) place(x, y, width, height int) {
+	v.originX, v.originY = x, y
+	v.resize(width, height)
+}
+
+// setCell draws a cell at a position of the view, offset by where the view is placed
+func (v *Viewer) setCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(v.originX+x, v.originY+y, ch, fg, bg)
+}
+
+// promptForInput shows a prompt at the bottom line and collects user input
+func (v *Viewer) promptForInput(prompt string) (string, bool) {
+	return v.editInput(prompt, "")
+}
+
+// editInput is promptForInput starting with input already typed
+func (v *Viewer) editInput(prompt, input string) (string, bool) {
+	for {
+		statusY := v.height
+		line := prompt + input
+
+		for i := 0; i < v.width; i++ {
+			v.setCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		}
+		for i, char := range line {
+			if i >= v.width {
+				break
+			}
+			v.setCell(i, statusY, char, termbox.ColorBlack, termbox.ColorWhite)
+		}
+		cursorPos := len([]rune(line))
+		if cursorPos < v.width {
+			termbox.SetCursor(v.originX+cursorPos, v.originY+statusY)
+		}
+		termbox.Flush()
+
+		ev := termbox.PollEvent()
+		switch ev.Type {
+		case termbox.EventKey:
+			if ev.Key == termbox.KeyEnter {
+				termbox.HideCursor()
+				return input, true
+			} else if ev.Key == termbox.KeyEsc {
+				termbox.HideCursor()
+				return "", false
+			} else if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
+				if len(input) > 0 {
+					runes := []rune(input)
+					input = string(runes[:len(runes)-1])
+				}
+			} else if ev.Ch != 0 {
+				input += string(ev.Ch)
+			} else if ev.Key == termbox.KeySpace {
+				input += " "
+			}
+		case termbox.EventResize:
+			termbox.Sync()
+			v.resize(ev.Width, ev.Height)
+			v.draw()
+		}
+	}
+}
+
+// promptWithModifiers prompts for input with regex (Ctrl+R), case (Ctrl+I), expression (Ctrl+E) toggles, and history
+// Returns: input string, isRegex flag, ignoreCase flag, isExpr flag, ok
+func (a *App) promptWithModifiers(prompt string) (string, bool, bool, bool, bool) {
+	return a.editWithModifiers(prompt, "", false, false, false)
+}
+
+// editWithModifiers is promptWithModifiers starting with a query and modifiers already set
+func (a *App) editWithModifiers(prompt, input string, isRegex, ignoreCase, isExpr bool) (string, bool, bool, bool, bool) {
+	v := a.stack.Current()
+	a.history.Reset()
+
+	for {
+		statusY := v.height
+		indicators := ""
+		if isRegex {
+			indicators += "[regex]"
+		}
+		if ignoreCase {
+			if indicators != "" {
+				indicators += " "
+			}
+			indicators += "[nocase]"
+		}
+		if isExpr {
+			if indicators != "" {
+				indicators += " "
+			}
+			indicators += "[expr]"
+		}
+		if indicators != "" {
+			indicators += " "
+		}
+		line := prompt + indicators + input
+
+		for i := 0; i < v.width; i++ {
+			v.setCell(i, statusY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		}
+		for i, char := range line {
+			if i >= v.width {
+				break
+			}
+			v.setCell(i, statusY, char, termbox.ColorBlack, termbox.ColorWhite)
+		}
+		cursorPos := len([]rune(line))
+		if cursorPos < v.width {
+			termbox.SetCursor(v.originX+cursorPos, v.originY+statusY)
+		}
+		termbox.Flush()
+
+		ev := termbox.PollEvent()
+		switch ev.Type {
+		case termbox.EventKey:
+			if ev.Key == termbox.KeyEnter {
+				termbox.HideCursor()
+				if input != "" {
+					a.history.AddWithModifiers(input, isRegex, ignoreCase, isExpr)
+				}
+				return input, isRegex, ignoreCase, isExpr, true
+			} else if ev.Key == termbox.KeyEsc {
+				termbox.HideCursor()
+				return "", false, false, false, false
+			} else if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
+				if len(input) > 0 {
+					runes := []rune(input)
+					input = string(runes[:len(runes)-1])
+				}
+			} else if ev.Key == termbox.KeyArrowUp {
+				input, isRegex, ignoreCase, isExpr = a.history.UpWithModifiers(input, isRegex, ignoreCase, isExpr)
+			} else if ev.Key == termbox.KeyArrowDown {
+				input, isRegex, ignoreCase, isExpr = a.history.DownWithModifiers(input, isRegex, ignoreCase, isExpr)
+			} else if ev.Key == termbox.KeyCtrlR {
+				isRegex = !isRegex
+			} else if ev.Key == termbox.KeyCtrlI {
+				ignoreCase = !ignoreCase
+			} else if ev.Key == termbox.KeyCtrlE {
+				isExpr = !isExpr
+			} else if ev.Ch != 0 {
+				input += string(ev.Ch)
+			} else if ev.Key == termbox.KeySpace {
+				input += " "
+			}
+		case termbox.EventResize:
+			termbox.Sync()
+			v.resize(ev.Width, ev.Height)
+			v.draw()
+		}
+	}
+}
+
+// NewViewerStack creates a new ViewerStack with the initial viewer
+func NewViewerStack(initial *Viewer) *ViewerStack {
+	return &ViewerStack{
+		viewers: []*Viewer{initial},
+	}
+}
+
+// Current returns the current (top) viewer
+func (s *ViewerStack) Current() *Viewer {
+	return s.viewers[len(s.viewers)-1]
+}
+
+// Push adds a new viewer to the stack, as a new branch of the current one
+func (s *ViewerStack) Push(v *Viewer) {
+	current := s.Current()
+	current.branches = append(current.branches, v)
+	current.visited = len(current.branches) - 1
+	s.viewers = append(s.viewers, v)
+}
+
+// Pop moves down to the viewer below the top one, returns false if only one viewer remains.
+// The top viewer stays in the tree and keeps filtering new lines.
+func (s *ViewerStack) Pop() bool {
+	if len(s.viewers) <= 1 {
+		return false
+	}
+	s.viewers = s.viewers[:len(s.viewers)-1]
+	return true
+}
+
+// Reset moves down to the first viewer, returns false if already at first
+func (s *ViewerStack) Reset() bool {
+	if len(s.viewers) <= 1 {
+		return false
+	}
+	s.viewers = s.viewers[:1]
+	return true
+}
+
+// Reenter moves back into the branch of the top viewer shown last, returns false if it has none
+func (s *ViewerStack) Reenter() bool {
+	current := s.Current()
+	if len(current.branches) == 0 {
+		return false
+	}
+	s.viewers = append(s.viewers, current.branches[current.visited])
+	return true
+}
+
+// Switch replaces the top viewer with its next (delta 1) or previous (delta -1) sibling,
+// wrapping around. Returns false if it has no siblings.
+func (s *ViewerStack) Switch(delta int) bool {
+	if len(s.viewers) <= 1 {
+		return false
+	}
+	parent := s.viewers[len(s.viewers)-2]
+	n := len(parent.branches)
+	if n <= 1 {
+		return false
+	}
+	parent.visited = (parent.visited + delta + n) % n
+	s.viewers[len(s.viewers)-1] = parent.branches[parent.visited]
+	return true
+}
+
+// Remove drops the top viewer and every view filtered from it, returns false if only one
+// viewer remains
+func (s *ViewerStack) Remove() bool {
+	if len(s.viewers) <= 1 {
+		return false
+	}
+	parent := s.viewers[len(s.viewers)-2]
+	parent.replaceBranch(s.Current(), nil)
+	s.viewers = s.viewers[:len(s.viewers)-1]
+	return true
+}
+
+// replaceBranch puts with in place of the branch old (removing it if with is nil) and
+// stops updating old and the views filtered from it
+func (v *Viewer) replaceBranch(old, with *Viewer) {
+	for i, branch := range v.branches {
+		if branch != old {
+			continue
+		}
+		if with != nil {
+			v.branches[i] = with
+		} else {
+			v.branches = append(v.branches[:i:i], v.branches[i+1:]...)
+			if v.visited >= i && v.visited > 0 {
+				v.visited--
+			}
+		}
+		break
+	}
+	old.unsubscribeTree()
+}
+
+// appendTree appends v and every view filtered from it to views
+func (v *Viewer) appendTree(views []*Viewer) []*Viewer {
+	views = append(views, v)
+	for _, b := range v.branches {
+		views = b.appendTree(views)
+	}
+	return views
+}
+
+// unsubscribeTree stops updating v and every view filtered from it
+func (v *Viewer) unsubscribeTree() {
+	v.unsubscribe()
+	for _, b := range v.branches {
+		b.unsubscribeTree()
+	}
+}
+
+// NewApp creates a new App with the given viewer
+func NewApp(viewer *Viewer) *App {
+	a := &App{
+		stack:       NewViewerStack(viewer),
+		search:      &SearchState{},
+		history:     NewHistory("/tmp/sieve_history"),
+		highlights:  loadHighlights(highlightsPath()),
+		levelColors: true,
+		jumpLevel:   levelWarn,
+	}
+	a.panes = []*pane{{stack: a.stack, search: a.search}}
+	a.tabs = []*tab{{panes: a.panes}}
+	return a
+}
+
+// ShowTempMessage displays a message for 3 seconds
+func (a *App) ShowTempMessage(msg string) {
+	a.statusMessage = msg
+	a.messageExpiry = time.Now().Add(3 * time.Second)
+	go func() {
+		time.Sleep(3 * time.Second)
+		termbox.Interrupt()
+	}()
+}
+
+// copyToClipboard copies text to system clipboard
+func copyToClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("pbcopy")
+	case "linux":
+		cmd = exec.Command("xclip", "-selection", "clipboard")
+	default:
+		return fmt.Errorf("clipboard not supported on %s", runtime.GOOS)
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// EnterVisualMode starts visual line selection
+func (a *App) EnterVisualMode() {
+	current := a.stack.Current()
+	a.visualMode = true
+	a.visualStart = current.topLine
+	a.visualStartOffset = current.topLineOffset
+	a.visualCursor = current.topLine
+	a.visualCursorOffset = current.topLineOffset
+}
+
+// ExitVisualMode exits visual mode without action
+func (a *App) ExitVisualMode() {
+	a.visualMode = false
+	a.visualStart = 0
+	a.visualStartOffset = 0
+	a.visualCursor = 0
+	a.visualCursorOffset = 0
+}
+
+// VisualCursorDown moves cursor down in visual mode, scrolling if needed
+func (a *App) VisualCursorDown() {
+	current := a.stack.Current()
+	lineCount := current.LineCount()
+
+	if current.wordWrap || current.jsonPretty {
+		// Row-by-row movement in wrap/json mode
+		expandedCount := current.getExpandedLineCount(a.visualCursor)
+		if a.visualCursorOffset < expandedCount-1 {
+			a.visualCursorOffset++
+		} else if a.visualCursor < lineCount-1 {
+			a.visualCursor++
+			a.visualCursorOffset = 0
+		}
+		// Scroll if cursor goes below visible area
+		a.visualScrollIfNeeded()
+	} else {
+		if a.visualCursor < lineCount-1 {
+			a.visualCursor++
+			// Scroll if cursor goes below visible area
+			if a.visualCursor >= current.topLine+current.height {
+				current.topLine++
+			}
+		}
+	}
+}
+
+// VisualCursorUp moves cursor up in visual mode, scrolling if needed
+func (a *App) VisualCursorUp() {
+	current := a.stack.Current()
+
+	if current.wordWrap || current.jsonPretty {
+		// Row-by-row movement in wrap/json mode
+		if a.visualCursorOffset > 0 {
+			a.visualCursorOffset--
+		} else if a.visualCursor > 0 {
+			a.visualCursor--
+			a.visualCursorOffset = current.getExpandedLineCount(a.visualCursor) - 1
+		}
+		// Scroll if cursor goes above visible area
+		a.visualScrollIfNeeded()
+	} else {
+		if a.visualCursor > 0 {
+			a.visualCursor--
+			// Scroll if cursor goes above visible area
+			if a.visualCursor < current.topLine {
+				current.topLine--
+			}
+		}
+	}
+}
+
+// visualScrollIfNeeded scrolls the view to keep visual cursor visible (for wrap/json mode)
+// visualCursorScreenRow calculates the screen row of the visual cursor relative to topLine
+func (a *App) visualCursorScreenRow(current *Viewer) int {
+	if a.visualCursor > current.topLine {
+		row := 0
+		for i := current.topLine; i < a.visualCursor; i++ {
+			row += current.getExpandedLineCount(i)
+		}
+		return row - current.topLineOffset + a.visualCursorOffset
+	} else if a.visualCursor == current.topLine {
+		return a.visualCursorOffset - current.topLineOffset
+	}
+	return -1 // Cursor is above topLine
+}
+
+func (a *App) visualScrollIfNeeded() {
+	current := a.stack.Current()
+
+	// Scroll down if cursor below visible area
+	for a.visualCursorScreenRow(current) >= current.height {
+		current.navigateDown()
+	}
+
+	// Scroll up if cursor above visible area
+	for a.visualCursorScreenRow(current) < 0 {
+		current.navigateUp()
+	}
+}
+
+// VisualPageDown moves cursor down by a page in visual mode
+func (a *App) VisualPageDown() {
+	current := a.stack.Current()
+	lineCount := current.LineCount()
+
+	if current.wordWrap || current.jsonPretty {
+		// Move by screen height rows
+		for i := 0; i < current.height; i++ {
+			a.VisualCursorDown()
+		}
+	} else {
+		a.visualCursor += current.height
+		if a.visualCursor >= lineCount {
+			a.visualCursor = lineCount - 1
+		}
+		// Scroll to keep cursor visible
+		if a.visualCursor >= current.topLine+current.height {
+			current.topLine = a.visualCursor - current.height + 1
+			if current.topLine < 0 {
+				current.topLine = 0
+			}
+		}
+	}
+}
+
+// VisualPageUp moves cursor up by a page in visual mode
+func (a *App) VisualPageUp() {
+	current := a.stack.Current()
+
+	if current.wordWrap || current.jsonPretty {
+		// Move by screen height rows
+		for i := 0; i < current.height; i++ {
+			a.VisualCursorUp()
+		}
+	} else {
+		a.visualCursor -= current.height
+		if a.visualCursor < 0 {
+			a.visualCursor = 0
+		}
+		// Scroll to keep cursor visible
+		if a.visualCursor < current.topLine {
+			current.topLine = a.visualCursor
+		}
+	}
+}
+
+// VisualGoToStart moves cursor to start of file in visual mode
+func (a *App) VisualGoToStart() {
+	current := a.stack.Current()
+	a.visualCursor = 0
+	a.visualCursorOffset = 0
+	current.topLine = 0
+	current.topLineOffset = 0
+}
+
+// VisualGoToEnd moves cursor to end of file in visual mode
+func (a *App) VisualGoToEnd() {
+	current := a.stack.Current()
+	lineCount := current.LineCount()
+	a.visualCursor = lineCount - 1
+	if current.wordWrap || current.jsonPretty {
+		a.visualCursorOffset = current.getExpandedLineCount(a.visualCursor) - 1
+	} else {
+		a.visualCursorOffset = 0
+	}
+	// Scroll to show cursor
+	a.visualScrollIfNeeded()
+}
+
+// YankVisualSelection copies selected lines to clipboard
+func (a *App) YankVisualSelection() {
+	if !a.visualMode {
+		return
+	}
+
+	current := a.stack.Current()
+
+	var lines []string
+	var rowCount int
+
+	if current.wordWrap || current.jsonPretty {
+		// Row-by-row yank in wrap/JSON mode
+		startLine := a.visualStart
+		startOff := a.visualStartOffset
+		endLine := a.visualCursor
+		endOff := a.visualCursorOffset
+
+		// Ensure start <= end
+		if startLine > endLine || (startLine == endLine && startOff > endOff) {
+			startLine, endLine = endLine, startLine
+			startOff, endOff = endOff, startOff
+		}
+
+		wrapWidth := current.width - current.getLineNumWidth()
+		if wrapWidth <= 0 {
+			wrapWidth = current.width
+		}
+
+		// Iterate through lines and collect selected rows
+		for lineIdx := startLine; lineIdx <= endLine; lineIdx++ {
+			line := current.GetLine(lineIdx)
+
+			// Expand the line (JSON or wrap)
+			var expandedRows []string
+			if current.jsonPretty && isJSON(line) {
+				expandedRows = formatJSON(line)
+			} else {
+				expandedRows = []string{line}
+			}
+
+			// If word wrap is enabled, further split each expanded row
+			var allRows []string
+			if current.wordWrap {
+				for _, row := range expandedRows {
+					cells := parseANSI(row)
+					if len(cells) == 0 {
+						allRows = append(allRows, "")
+					} else {
+						// Split into wrapped rows
+						for i := 0; i < len(cells); i += wrapWidth {
+							end := i + wrapWidth
+							if end > len(cells) {
+								end = len(cells)
+							}
+							var rowChars []rune
+							for j := i; j < end; j++ {
+								rowChars = append(rowChars, cells[j].char)
+							}
+							allRows = append(allRows, string(rowChars))
+						}
+					}
+				}
+			} else {
+				// JSON mode without wrap - each JSON line is a row
+				for _, row := range expandedRows {
+					allRows = append(allRows, stripANSI(row))
+				}
+			}
+
+			// Determine which rows to include from this line
+			rowStart := 0
+			rowEnd := len(allRows) - 1
+
+			if lineIdx == startLine {
+				rowStart = startOff
+			}
+			if lineIdx == endLine {
+				rowEnd = endOff
+			}
+
+			// Collect the selected rows
+			for rowIdx := rowStart; rowIdx <= rowEnd && rowIdx < len(allRows); rowIdx++ {
+				lines = append(lines, allRows[rowIdx])
+				rowCount++
+			}
+		}
+	} else {
+		// Normal mode - yank entire logical lines
+		startLine := a.visualStart
+		endLine := a.visualCursor
+
+		if startLine > endLine {
+			startLine, endLine = endLine, startLine
+		}
+
+		for i := startLine; i <= endLine; i++ {
+			lines = append(lines, stripANSI(current.GetLine(i)))
+		}
+		rowCount = len(lines)
+	}
+
+	text := strings.Join(lines, "\n")
+	err := copyToClipboard(text)
+
+	a.visualMode = false
+	a.visualStart = 0
+	a.visualStartOffset = 0
+	a.visualCursor = 0
+	a.visualCursorOffset = 0
+
+	if err != nil {
+		a.ShowTempMessage("Clipboard error: " + err.Error())
+	} else {
+		a.ShowTempMessage(fmt.Sprintf("Yanked %d row(s)", rowCount))
+	}
+}
+
+// pythonToGoFormat converts Python datetime format to Go time format
+func pythonToGoFormat(pyFormat string) string {
+	replacements := []struct{ py, go_ string }{
+		{"%Y", "2006"},
+		{"%y", "06"},
+		{"%m", "01"},
+		{"%-d", "2"},  // day without zero padding
+		{"%d", "02"},
+		{"%H", "15"},
+		{"%I", "03"},
+		{"%M", "04"},
+		{"%S", "05"},
+		{"%f", "000000"},
+		{"%p", "PM"},
+		{"%z", "-0700"},
+		{"%Z", "MST"},
+		{"%j", "002"},
+		{"%a", "Mon"},
+		{"%A", "Monday"},
+		{"%b", "Jan"},
+		{"%B", "January"},
+		{"%_d", "_2"}, // space-padded day (for syslog)
+	}
+	result := pyFormat
+	for _, r := range replacements {
+		result = strings.ReplaceAll(result, r.py, r.go_)
+	}
+	return result
+}
+
+// Common timestamp formats to try for auto-detection
+var commonTimestampFormats = []string{
+	// More specific formats first (with microseconds/milliseconds)
+	"%Y-%m-%d %H:%M:%S.%f", // 2026-01-06 15:48:10.192158
+	"%Y-%m-%dT%H:%M:%S.%f", // 2026-01-06T15:48:10.192158
+	// Standard formats
+	"%Y-%m-%d %H:%M:%S",
+	"%Y-%m-%dT%H:%M:%S",
+	"%Y/%m/%d %H:%M:%S",
+	"%d/%m/%Y %H:%M:%S",
+	"%m/%d/%Y %H:%M:%S",
+	"%b %_d %H:%M:%S", // syslog: Jan  4 00:00:01 (space-padded day), before its bare time
+	"%b %d %H:%M:%S",  // syslog variant with zero-padded day
+	"%H:%M:%S",
+	"%Y%m%d%H%M%S",
+	"[%Y-%m-%d %H:%M:%S]",
+	"%d-%b-%Y %H:%M:%S",
+}
+
+// detectTimestampFormat tries to detect timestamp format from a line
+func detectTimestampFormat(line string) string {
+	for _, pyFmt := range commonTimestampFormats {
+		goFmt := pythonToGoFormat(pyFmt)
+		// Try to find a matching timestamp in the line
+		// We'll try parsing substrings of appropriate length
+		fmtLen := len(goFmt)
+		for i := 0; i <= len(line)-fmtLen && i < 50; i++ {
+			substr := line[i : i+fmtLen]
+			_, err := time.Parse(goFmt, substr)
+			if err == nil {
+				return pyFmt
+			}
+		}
+	}
+	return ""
+}
+
+// extractTimestamp extracts and parses timestamp from a line using the given format
+func extractTimestamp(line, pyFormat string) (time.Time, bool) {
+	goFmt := pythonToGoFormat(pyFormat)
+	fmtLen := len(goFmt)
+	
+	for i := 0; i <= len(line)-fmtLen && i < 100; i++ {
+		substr := line[i : i+fmtLen]
+		t, err := time.Parse(goFmt, substr)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// HandleSetTimestampFormat prompts for Python datetime format string
+func (a *App) HandleSetTimestampFormat() {
+	current := a.stack.Current()
+	input, ok := current.promptForInput("t (timestamp format): ")
+	if !ok {
+		return
+	}
+	if input == "" {
+		a.timestampFormat = ""
+		a.ShowTempMessage("Timestamp format cleared")
+		return
+	}
+	a.timestampFormat = input
+	a.ShowTempMessage(fmt.Sprintf("Format set: %s", input))
+}
+
+// HandleTimestampSearch searches for a timestamp
+func (a *App) HandleTimestampSearch() {
+	current := a.stack.Current()
+	
+	// Get input: 6 digits (hhmmss) or 12 digits (yymmddhhmmss)
+	input, ok := current.promptForInput("b (timestamp [yymmdd]hhmmss): ")
+	if !ok || input == "" {
+		return
+	}
+	
+	// Validate input
+	if len(input) != 6 && len(input) != 12 {
+		a.ShowTempMessage("Enter 6 (hhmmss) or 12 (yymmddhhmmss) digits")
+		return
+	}
+	for _, c := range input {
+		if c < '0' || c > '9' {
+			a.ShowTempMessage("Enter digits only")
+			return
+		}
+	}
+	
+	// Parse target time
+	var targetTime time.Time
+	now := time.Now()
+	if len(input) == 6 {
+		// hhmmss - use today's date
+		h, _ := strconv.Atoi(input[0:2])
+		m, _ := strconv.Atoi(input[2:4])
+		s, _ := strconv.Atoi(input[4:6])
+		targetTime = time.Date(now.Year(), now.Month(), now.Day(), h, m, s, 0, time.Local)
+	} else {
+		// yymmddhhmmss
+		y, _ := strconv.Atoi(input[0:2])
+		mo, _ := strconv.Atoi(input[2:4])
+		d, _ := strconv.Atoi(input[4:6])
+		h, _ := strconv.Atoi(input[6:8])
+		mi, _ := strconv.Atoi(input[8:10])
+		s, _ := strconv.Atoi(input[10:12])
+		year := 2000 + y
+		if y > 50 {
+			year = 1900 + y
+		}
+		targetTime = time.Date(year, time.Month(mo), d, h, mi, s, 0, time.Local)
+	}
+	
+	// Detect or use set format
+	format := a.timestampFormat
+	if format == "" {
+		// Try to detect from current line
+		line := current.GetLine(current.topLine)
+		format = detectTimestampFormat(line)
+		if format == "" {
+			a.ShowTempMessage("Couldn't detect timestamp format. Use 't' to set.")
+			return
+		}
+	}
+	
+	// Search from current line to end
+	src := current.Snapshot()
+	for i := current.topLine; i < src.Len(); i++ {
+		ts, ok := extractTimestamp(src.Line(i), format)
+		if ok {
+			// For time-only searches, adjust the date to match
+			if len(input) == 6 {
+				ts = time.Date(now.Year(), now.Month(), now.Day(), ts.Hour(), ts.Minute(), ts.Second(), 0, time.Local)
+			}
+			if ts.Equal(targetTime) || ts.After(targetTime) {
+				current.topLine = i
+				a.ShowTempMessage(fmt.Sprintf("Found at line %d", i+1))
+				return
+			}
+		}
+	}
+	a.ShowTempMessage("No matching timestamp found")
+}
+
+// timelineSteps are the bucket sizes of the timeline panel. Spans too long for them
+// use whole days.
+var timelineSteps = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// stampedLine is a line of a view with its timestamp
+type stampedLine struct {
+	ts   time.Time
+	line int
+}
+
+// timeline counts lines in buckets of equal time for the timeline panel
+type timeline struct {
+	start  time.Time
+	step   time.Duration
+	counts []int
+	first  []int // Line of the view each bucket starts at (-1 if empty)
+}
+
+// newTimeline buckets the stamped lines into at most columns buckets of a round size
+func newTimeline(stamps []stampedLine, columns int) *timeline {
+	lo, hi := stamps[0].ts, stamps[0].ts
+	for _, s := range stamps {
+		if s.ts.Before(lo) {
+			lo = s.ts
+		}
+		if s.ts.After(hi) {
+			hi = s.ts
+		}
+	}
+	columns = max(columns, 1)
+
+	fits := func(step time.Duration) bool {
+		return int(hi.Sub(lo.Truncate(step))/step) < columns
+	}
+	step := time.Duration(0)
+	for _, s := range timelineSteps {
+		if fits(s) {
+			step = s
+			break
+		}
+	}
+	for days := time.Duration(2); step == 0; days++ {
+		if fits(days * 24 * time.Hour) {
+			step = days * 24 * time.Hour
+		}
+	}
+
+	t := &timeline{start: lo.Truncate(step), step: step}
+	n := int(hi.Sub(t.start)/step) + 1
+	t.counts = make([]int, n)
+	t.first = make([]int, n)
+	for i := range t.first {
+		t.first[i] = -1
+	}
+	for _, s := range stamps {
+		b := int(s.ts.Sub(t.start) / step)
+		t.counts[b]++
+		if t.first[b] == -1 || s.line < t.first[b] {
+			t.first[b] = s.line
+		}
+	}
+	return t
+}
+
+// timeLayout returns how times of a timeline are shown, with the date only when it
+// has one and the seconds only when buckets are shorter than a minute
+func (t *timeline) timeLayout() string {
+	layout := "15:04"
+	if t.step < time.Minute {
+		layout = "15:04:05"
+	}
+	if t.step >= 24*time.Hour {
+		layout = "2006-01-02"
+	} else if t.start.Year() > 0 {
+		layout = "2006-01-02 " + layout
+	}
+	return layout
+}
+
+// HandleTimeline shows how the lines of the current view (or the search matches if
+// there are any) spread over time, as a bar chart with a bucket per column. A bucket
+// can be selected to jump to its first line.
+func (a *App) HandleTimeline() {
+	current := a.stack.Current()
+	src := current.Snapshot()
+
+	lines := a.search.matches
+	what := "matches"
+	if !a.search.HasResults() {
+		lines = make([]int, src.Len())
+		for i := range lines {
+			lines[i] = i
+		}
+		what = "lines"
+	}
+
+	format := a.timestampFormat
+	for i := 0; format == "" && i < len(lines) && i < 1000; i++ {
+		format = detectTimestampFormat(stripANSI(src.Line(lines[i])))
+	}
+	if format == "" {
+		a.ShowTempMessage("Couldn't detect timestamp format. Use 't' to set.")
+		return
+	}
+	var stamps []stampedLine
+	for _, i := range lines {
+		line := src.Line(i)
+		if src.HasANSI(i) {
+			line = stripANSI(line)
+		}
+		if ts, ok := extractTimestamp(line, format); ok {
+			stamps = append(stamps, stampedLine{ts, i})
+		}
+	}
+	if len(stamps) == 0 {
+		a.ShowTempMessage("No timestamps found")
+		return
+	}
+
+	var t *timeline
+	selected := -1
+	for {
+		width, height := termbox.Size()
+		boxWidth := max(width-4, 20)
+		columns := boxWidth - 4
+		if t == nil || len(t.counts) > columns {
+			t = newTimeline(stamps, columns)
+			if selected < 0 || selected >= len(t.counts) {
+				// Start at the bucket of the top line
+				selected = 0
+				for b, first := range t.first {
+					if first != -1 && first <= current.topLine {
+						selected = b
+					}
+				}
+			}
+		}
+		a.drawTimeline(t, selected, what, boxWidth, min(height-2, 20))
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+			t = nil
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'i':
+			return
+		case ev.Key == termbox.KeyArrowLeft || ev.Ch == 'h':
+			selected = max(selected-1, 0)
+		case ev.Key == termbox.KeyArrowRight || ev.Ch == 'l':
+			selected = min(selected+1, len(t.counts)-1)
+		case ev.Ch == 'H':
+			selected = max(selected-10, 0)
+		case ev.Ch == 'L':
+			selected = min(selected+10, len(t.counts)-1)
+		case ev.Key == termbox.KeyHome || ev.Ch == 'g':
+			selected = 0
+		case ev.Key == termbox.KeyEnd || ev.Ch == 'G':
+			selected = len(t.counts) - 1
+		case ev.Key == termbox.KeyEnter && t.first[selected] != -1:
+			current.topLine = t.first[selected]
+			current.topLineOffset = 0
+			return
+		}
+	}
+}
+
+// timelineBlocks are the bars of the timeline chart in eighths of a row
+var timelineBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// drawTimeline draws the timeline panel over the current view
+func (a *App) drawTimeline(t *timeline, selected int, what string, boxWidth, boxHeight int) {
+	a.Draw()
+	startX, startY, drawText := drawBox("Timeline of "+what, boxWidth, boxHeight)
+	bgColor := termbox.ColorDefault
+	chartHeight := max(boxHeight-6, 1)
+
+	peak := 1
+	for _, c := range t.counts {
+		peak = max(peak, c)
+	}
+	for b, c := range t.counts {
+		// Bar height in eighths of a row, at least one for a bucket with lines
+		eighths := (c*chartHeight*8 + peak - 1) / peak
+		fg := termbox.ColorCyan
+		if b == selected {
+			fg = termbox.ColorYellow
+		}
+		for row := 0; row < chartHeight; row++ {
+			fill := min(max(eighths-row*8, 0), 8)
+			ch := timelineBlocks[fill]
+			if ch == ' ' && b == selected {
+				ch = '·'
+			}
+			termbox.SetCell(startX+2+b, startY+1+chartHeight-row, ch, fg, bgColor)
+		}
+	}
+
+	// Axis: first and last bucket
+	layout := t.timeLayout()
+	axisY := startY + 2 + chartHeight
+	dim := termbox.ColorDefault | termbox.AttrDim
+	drawText(startX+2, axisY, t.start.Format(layout), dim, bgColor)
+	last := t.start.Add(time.Duration(len(t.counts)-1) * t.step).Format(layout)
+	if endX := startX + 2 + len(t.counts) - len(last); endX > startX+2+len(layout)+2 {
+		drawText(endX, axisY, last, dim, bgColor)
+	}
+
+	from := t.start.Add(time.Duration(selected) * t.step)
+	info := fmt.Sprintf("%s - %s  %d %s", from.Format(layout), from.Add(t.step).Format(layout), t.counts[selected], what)
+	drawText(startX+2, axisY+1, info, termbox.ColorDefault, bgColor)
+	drawText(startX+2, startY+boxHeight-2, "h/l:move  H/L:move 10  Enter:jump  q:close", dim, bgColor)
+	termbox.Flush()
+}
+
+// timeRange is the span of a time-range filter. Timestamps are compared by their wall
+// clock; when the bounds have no date they're times of day matched on every day.
+type timeRange struct {
+	from, to time.Time // Start (inclusive) and end (exclusive), zero when open
+	clock    bool      // Bounds are times of day (dates are ignored)
+}
+
+// timeBoundLayouts are the accepted range bounds with the precision of each
+var timeBoundLayouts = []struct {
+	layout    string
+	precision time.Duration
+	hasDate   bool
+}{
+	{"2006-01-02T15:04:05", time.Second, true},
+	{"2006-01-02 15:04:05", time.Second, true},
+	{"2006-01-02T15:04", time.Minute, true},
+	{"2006-01-02 15:04", time.Minute, true},
+	{"2006-01-02", 24 * time.Hour, true},
+	{"060102150405", time.Second, true}, // Same digits as the b prompt
+	{"15:04:05", time.Second, false},
+	{"15:04", time.Minute, false},
+	{"150405", time.Second, false},
+}
+
+// parseTimeBound parses a range bound, returning the span it covers (10:05 covers a minute)
+func parseTimeBound(s string) (time.Time, time.Duration, bool, error) {
+	for _, b := range timeBoundLayouts {
+		if t, err := time.Parse(b.layout, s); err == nil {
+			// Fractional seconds are accepted after whole seconds and are exact
+			if strings.Contains(s, ".") {
+				return t, time.Nanosecond, b.hasDate, nil
+			}
+			return t, b.precision, b.hasDate, nil
+		}
+	}
+	return time.Time{}, 0, false, fmt.Errorf("can't parse time %q", s)
+}
+
+// parseTimeRange parses "from..to". Either bound may be omitted, and one of them may be
+// relative to the other: 22:00..+15m or -5m..2026-10-15T22:00.
+func parseTimeRange(input string) (timeRange, error) {
+	fromStr, toStr, ok := strings.Cut(input, "..")
+	if !ok {
+		return timeRange{}, fmt.Errorf("use from..to")
+	}
+	fromStr, toStr = strings.TrimSpace(fromStr), strings.TrimSpace(toStr)
+	if fromStr == "" && toStr == "" {
+		return timeRange{}, fmt.Errorf("use from..to")
+	}
+
+	var r timeRange
+	var fromDate, toDate bool
+	var fromDur, toDur time.Duration
+	var err error
+	if strings.HasPrefix(fromStr, "-") {
+		if fromDur, err = time.ParseDuration(fromStr[1:]); err != nil {
+			return timeRange{}, err
+		}
+	} else if fromStr != "" {
+		if r.from, _, fromDate, err = parseTimeBound(fromStr); err != nil {
+			return timeRange{}, err
+		}
+	}
+	if strings.HasPrefix(toStr, "+") {
+		if toDur, err = time.ParseDuration(toStr[1:]); err != nil {
+			return timeRange{}, err
+		}
+	} else if toStr != "" {
+		var precision time.Duration
+		if r.to, precision, toDate, err = parseTimeBound(toStr); err != nil {
+			return timeRange{}, err
+		}
+		// The end is inclusive at the precision it was given
+		r.to = r.to.Add(precision)
+	}
+
+	switch {
+	case fromDur != 0 && toDur != 0, fromDur != 0 && r.to.IsZero(), toDur != 0 && r.from.IsZero():
+		return timeRange{}, fmt.Errorf("a relative bound needs the other bound")
+	case fromDur != 0:
+		r.from = r.to.Add(-fromDur)
+	case toDur != 0:
+		r.to = r.from.Add(toDur)
+	}
+	fromAbsolute := fromStr != "" && fromDur == 0
+	toAbsolute := toStr != "" && toDur == 0
+	if fromAbsolute && toAbsolute && fromDate != toDate {
+		return timeRange{}, fmt.Errorf("give both bounds a date, or neither")
+	}
+	r.clock = (fromAbsolute && !fromDate) || (toAbsolute && !toDate)
+	return r, nil
+}
+
+// contains reports whether a timestamp is in the range
+func (r timeRange) contains(ts time.Time) bool {
+	wall := time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), time.UTC)
+	if !r.clock {
+		return (r.from.IsZero() || !wall.Before(r.from)) && (r.to.IsZero() || wall.Before(r.to))
+	}
+
+	// Compare times of day. Bounds without a date parse on day 0, so ends past midnight
+	// (22:00..+4h) are more than 24h in and starts before it (-1h..00:30) are negative.
+	// An end before the start (22:00..02:00) is on the next day.
+	day0 := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	from, to := time.Duration(0), 24*time.Hour
+	if !r.from.IsZero() {
+		from = r.from.Sub(day0)
+	}
+	if !r.to.IsZero() {
+		to = r.to.Sub(day0)
+	}
+	if from < 0 {
+		from, to = from+24*time.Hour, to+24*time.Hour
+	}
+	if to <= from {
+		to += 24 * time.Hour
+	}
+	if to-from >= 24*time.Hour {
+		return true
+	}
+	t := wall.Sub(wall.Truncate(24 * time.Hour))
+	return (t >= from && t < to) || (t+24*time.Hour >= from && t+24*time.Hour < to)
+}
+
+// containsYearless reports whether a timestamp without a year (syslog's Jan 2 15:04:05)
+// is in the range, taking the year from the bounds. A range over new year tries both.
+func (r timeRange) containsYearless(ts time.Time) bool {
+	for _, bound := range []time.Time{r.from, r.to} {
+		if bound.IsZero() {
+			continue
+		}
+		if r.contains(time.Date(bound.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), time.UTC)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatHasDate reports whether a Python timestamp format has a month or day of the year
+func formatHasDate(format string) bool {
+	for _, directive := range []string{"%m", "%d", "%-d", "%_d", "%b", "%B", "%j"} {
+		if strings.Contains(format, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleTimeRangeFilter keeps lines with timestamps in a range. Lines without a
+// timestamp belong to the line before them (stack traces, multi-line messages).
+func (a *App) HandleTimeRangeFilter() {
+	input, ok := a.stack.Current().promptForInput("T (time range from..to): ")
+	if !ok || input == "" {
+		return
+	}
+	a.pushFilter(&filterSpec{op: 'T', query: input})
+}
+
+// newTimeRangeView creates a view of current with the lines in the time range of spec
+func (a *App) newTimeRangeView(current *Viewer, spec *filterSpec, topLine int) (*Viewer, error) {
+	r, err := parseTimeRange(spec.query)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid time range: %v", err)
+	}
+
+	// Detect or use set format
+	src := current.Snapshot()
+	format := a.timestampFormat
+	for i := topLine; format == "" && i < src.Len() && i < topLine+1000; i++ {
+		format = detectTimestampFormat(src.Line(i))
+	}
+	if format == "" {
+		// current may still be loading when the filter stack is rebuilt
+		rootSrc := current.root().Snapshot()
+		for i := 0; format == "" && i < rootSrc.Len() && i < 1000; i++ {
+			format = detectTimestampFormat(rootSrc.Line(i))
+		}
+	}
+	if format == "" {
+		return nil, fmt.Errorf("Couldn't detect timestamp format. Use 't' to set.")
+	}
+	hasYear := strings.Contains(format, "%Y") || strings.Contains(format, "%y")
+	if !r.clock && !hasYear && !formatHasDate(format) {
+		return nil, fmt.Errorf("Timestamps have no date, use times only (10:00..11:00)")
+	}
+
+	// Lines are matched in order, each one remembers whether the last timestamp was in range.
+	// Only this view's own updates run match, one at a time.
+	inRange := false
+	match := func(line string, hasANSI bool) bool {
+		if hasANSI {
+			line = stripANSI(line)
+		}
+		if ts, ok := extractTimestamp(line, format); ok {
+			if hasYear || r.clock {
+				inRange = r.contains(ts)
+			} else {
+				inRange = r.containsYearless(ts)
+			}
+		}
+		return inRange
+	}
+
+	// Create new viewer immediately with loading state
+	newViewer := &Viewer{
+		parent:   current,
+		loading:  true,
+		filename: current.filename,
+		topLine:  0,
+		leftCol:  0,
+		match:    match,
+		filter:   spec,
+	}
+	current.subscribe(newViewer)
+
+	// Scan sequentially, since lines inherit the time of the line before them
+	go newViewer.scanLines(src, topLine)
+	return newViewer, nil
+}
+
+// scanLines runs the lines of src (a snapshot of the parent) through match in order,
+// for filters where a line depends on the ones before it, and streams the results into
+// the loading view v
+func (v *Viewer) scanLines(src lineSource, topLine int) {
+	totalLines := src.Len()
+	foundMatch := false
+	lineCount := 0
+	for i := 0; i < totalLines; i++ {
+		if !v.match(src.Line(i), src.HasANSI(i)) {
+			continue
+		}
+		v.mu.Lock()
+		v.originIndices = append(v.originIndices, i)
+		if i >= topLine && !foundMatch {
+			foundMatch = true
+			v.topLine = len(v.originIndices) - 1
+		}
+		v.mu.Unlock()
+
+		lineCount++
+		if lineCount <= 100 || lineCount%1000 == 0 {
+			termbox.Interrupt()
+		}
+	}
+	v.finishLoading(totalLines)
+}
+
+// recordRule decides which lines start a record in record mode. The other lines
+// continue the record above them (stack traces, wrapped messages), and filters and
+// search match whole records.
+type recordRule struct {
+	start  *regexp.Regexp // Lines matching start a record (nil uses the default rule)
+	format string         // Timestamp format of the default rule ("" if unknown)
+}
+
+// forSource returns the rule to split src with, detecting the timestamp format for the
+// default rule from its first lines unless format is given
+func (r *recordRule) forSource(src lineSource, format string) *recordRule {
+	if r == nil || r.start != nil || r.format != "" {
+		return r
+	}
+	for i := 0; format == "" && i < src.Len() && i < 1000; i++ {
+		format = detectTimestampFormat(src.Line(i))
+	}
+	return &recordRule{format: format}
+}
+
+// isStart reports whether a line starts a record. By default indented lines continue
+// a record, and so do lines without a timestamp when the format is known.
+func (r *recordRule) isStart(line string) bool {
+	if lineHasANSI(line) {
+		line = stripANSI(line)
+	}
+	if r.start != nil {
+		return r.start.MatchString(line)
+	}
+	if line == "" || line[0] == ' ' || line[0] == '\t' {
+		return false
+	}
+	if r.format != "" {
+		_, ok := extractTimestamp(line, r.format)
+		return ok
+	}
+	return true
+}
+
+// forEachRecord calls fn with the bounds [start, end) of each record of src that starts
+// in [from, to). The last record may run past to.
+func (r *recordRule) forEachRecord(src lineSource, from, to int, fn func(start, end int)) {
+	// A record started before from belongs to whoever handles the lines before it
+	i := from
+	for i > 0 && i < to && !r.isStart(src.Line(i)) {
+		i++
+	}
+	total := src.Len()
+	for i < to {
+		end := i + 1
+		for end < total && !r.isStart(src.Line(end)) {
+			end++
+		}
+		fn(i, end)
+		i = end
+	}
+}
+
+// recordBounds returns the bounds [start, end) of the record containing line i of src
+func (r *recordRule) recordBounds(src lineSource, i int) (int, int) {
+	start := i
+	for start > 0 && !r.isStart(src.Line(start)) {
+		start--
+	}
+	end := i + 1
+	for end < src.Len() && !r.isStart(src.Line(end)) {
+		end++
+	}
+	return start, end
+}
+
+// recordText joins the lines of a record for matching
+func recordText(src lineSource, start, end int) (string, bool) {
+	if end-start == 1 {
+		return src.Line(start), src.HasANSI(start)
+	}
+	lines := make([]string, 0, end-start)
+	hasANSI := false
+	for i := start; i < end; i++ {
+		lines = append(lines, src.Line(i))
+		hasANSI = hasANSI || src.HasANSI(i)
+	}
+	return strings.Join(lines, "\n"), hasANSI
+}
+
+// wholeRecords extends the lines of a view's snapshot to the whole records of the root
+// they belong to, so views that show only part of a record still export all of it
+func (r *recordRule) wholeRecords(src lineSource) lineSource {
+	src, indices := rootIndices(src)
+	var lines []int
+	next := 0
+	for _, i := range indices {
+		if i < next {
+			continue
+		}
+		start, end := r.recordBounds(src, i)
+		for j := max(start, next); j < end; j++ {
+			lines = append(lines, j)
+		}
+		next = end
+	}
+	return &indexedSource{parent: src, indices: lines}
+}
+
+// rootIndices maps the lines of a view's snapshot through the filter chain, returning
+// the root's snapshot and the root line each line shows (in increasing order)
+func rootIndices(src lineSource) (lineSource, []int) {
+	indices := make([]int, src.Len())
+	for i := range indices {
+		indices[i] = i
+	}
+	for {
+		s, ok := src.(*indexedSource)
+		if !ok {
+			return src, indices
+		}
+		for i, idx := range indices {
+			indices[i] = s.indices[idx]
+		}
+		src = s.parent
+	}
+}
+
+// rootIndicesFrom returns the lines of the root source that src shows, from line from of
+// the root on
+func rootIndicesFrom(src lineSource, from int) []int {
+	rootOf := func(i int) int {
+		for s := src; ; {
+			is, ok := s.(*indexedSource)
+			if !ok {
+				return i
+			}
+			i, s = is.indices[i], is.parent
+		}
+	}
+	start := sort.Search(src.Len(), func(i int) bool { return rootOf(i) >= from })
+	indices := make([]int, 0, src.Len()-start)
+	for i := start; i < src.Len(); i++ {
+		indices = append(indices, rootOf(i))
+	}
+	return indices
+}
+
+// trackLastRecord records which lines of the last record of src a filtered view shows,
+// so live updates can extend the record
+func (v *Viewer) trackLastRecord(src lineSource) {
+	if v.records == nil || src.Len() == 0 {
+		return
+	}
+	v.recStart, _ = v.records.recordBounds(src, src.Len()-1)
+	v.recShown = 0
+	if indices := v.OriginIndices(); len(indices) > 0 && indices[len(indices)-1] == src.Len()-1 {
+		v.recShown = src.Len() - v.recStart
+	}
+}
+
+// HandleRecordMode toggles record mode, prompting for the regex of record start lines
+func (a *App) HandleRecordMode() {
+	root := a.stack.viewers[0].root()
+	if root.records != nil {
+		root.records = nil
+		a.ShowTempMessage("Record mode OFF")
+		return
+	}
+
+	input, ok := a.stack.Current().promptForInput("R (record start regex, empty for indent/timestamp): ")
+	if !ok {
+		return
+	}
+	rule := &recordRule{format: a.timestampFormat}
+	if input != "" {
+		re, err := regexp.Compile(input)
+		if err != nil {
+			a.ShowTempMessage("Invalid regex: " + err.Error())
+			return
+		}
+		rule.start = re
+	}
+	root.records = rule
+	a.ShowTempMessage("Record mode ON")
+}
+
+
+// ShowHelp displays the help screen
+func (a *App) ShowHelp() {
+	type helpEntry struct {
+		key  string
+		desc string
+	}
+
+	sections := []struct {
+		title   string
+		entries []helpEntry
+	}{
+		{"Navigation", []helpEntry{
+			{"j / ↓", "Move down one line"},
+			{"k / ↑", "Move up one line"},
+			{"h / ←", "Scroll left"},
+			{"l / →", "Scroll right"},
+			{"< / >", "Scroll left/right by 1 char"},
+			{"g / Home", "Go to first line"},
+			{"G / End", "Go to last line"},
+			{"Ctrl+D/Space/PgDn", "Page down"},
+			{"Ctrl+U/PgUp", "Page up"},
+			{":<number>", "Go to specific line number"},
+		}},
+		{"Search", []helpEntry{
+			{"/", "Search forward"},
+			{"?", "Search backward"},
+			{"n", "Next match"},
+			{"N", "Previous match"},
+			{"Ctrl+R", "Toggle regex mode (in prompt)"},
+			{"Ctrl+I", "Toggle case-insensitive (in prompt)"},
+			{"Ctrl+E", "Toggle filter expression (in prompt)"},
+		}},
+		{"Timestamp", []helpEntry{
+			{"t", "Set timestamp format (Python style)"},
+			{"b", "Jump to timestamp ([yymmdd]hhmmss)"},
+			{"T", "Keep lines in a time range (from..to)"},
+			{"i", "Timeline of lines (or search matches)"},
+		}},
+		{"Log Levels", []helpEntry{
+			{"e / E", "Next/previous line at the jump level or above"},
+			{"V", "Set the jump level (default warn)"},
+			{"C", "Toggle coloring lines by level"},
+		}},
+		{"Filters", []helpEntry{
+			{"&", "Keep lines matching pattern"},
+			{"-", "Exclude lines matching pattern"},
+			{"+", "Add matching from original file"},
+			{"!", "Keep lines at a log level or above"},
+			{"=", "Reset to original file"},
+			{"U", "Go back one level (keeps the branch)"},
+			{"[ / ]", "Previous/next sibling branch"},
+			{"D", "Go back into the branch left with U"},
+			{"X", "Close the current branch"},
+			{"S", "Edit the filter stack"},
+			{"R", "Toggle record mode (multi-line records)"},
+			{"p", "Top message patterns (keep/exclude one)"},
+			{"u", "Values of a field with counts (keep/exclude one)"},
+			{"d", "Diff with a level of the stack or a file"},
+		}},
+		{"Display", []helpEntry{
+			{"w", "Toggle word wrap"},
+			{"f", "Toggle JSON pretty-print"},
+			{"F", "Toggle follow mode (tail -f)"},
+			{"K", "Set sticky left columns"},
+			{"L", "Toggle line numbers"},
+			{"c", "Edit highlight rules"},
+		}},
+		{"Panes", []helpEntry{
+			{"Ctrl+W s / v", "Split stacked / side by side"},
+			{"Ctrl+W w / W", "Next / previous pane"},
+			{"Ctrl+W c / o", "Close the pane / all other panes"},
+			{"Ctrl+W t", "Toggle scrolling panes together by time"},
+		}},
+		{"Marks", []helpEntry{
+			{"m{a-z}", "Mark the top line"},
+			{"'{a-z}", "Jump to a mark"},
+			{"M", "List marks"},
+		}},
+		{"Notes", []helpEntry{
+			{"a", "Add or edit the note on the top line"},
+			{"A", "List notes"},
+		}},
+		{"Tabs", []helpEntry{
+			{"o", "Open a file in a new tab"},
+			{"Tab / Ctrl+N", "Next tab"},
+			{"Ctrl+P", "Previous tab"},
+			{"x", "Close the tab"},
+		}},
+		{"Selection & Export", []helpEntry{
+			{"v", "Enter visual selection mode"},
+			{"y", "Yank (copy) selected lines"},
+			{";", "Export filtered view to file"},
+			{"Esc", "Exit visual mode"},
+		}},
+		{"Help", []helpEntry{
+			{"H / F1", "Show this help screen"},
+			{"q", "Quit"},
+		}},
+	}
+
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	width, height := termbox.Size()
+
+	// Use nearly full screen with some margin
+	margin := 2
+	boxWidth := width - margin*2
+	boxHeight := height - margin*2
+	if boxWidth < 40 {
+		boxWidth = 40
+	}
+	if boxHeight < 20 {
+		boxHeight = 20
+	}
+	if boxWidth > width {
+		boxWidth = width
+	}
+	if boxHeight > height {
+		boxHeight = height
+	}
+	startX := (width - boxWidth) / 2
+	startY := (height - boxHeight) / 2
+
+	// Colors
+	borderFg := termbox.ColorCyan
+	titleFg := termbox.ColorYellow | termbox.AttrBold
+	sectionFg := termbox.ColorGreen | termbox.AttrBold
+	keyFg := termbox.ColorWhite | termbox.AttrBold
+	descFg := termbox.ColorDefault
+	bgColor := termbox.ColorDefault
+
+	// Draw border
+	drawBox := func(x, y, w, h int) {
+		// Corners
+		termbox.SetCell(x, y, '╭', borderFg, bgColor)
+		termbox.SetCell(x+w-1, y, '╮', borderFg, bgColor)
+		termbox.SetCell(x, y+h-1, '╰', borderFg, bgColor)
+		termbox.SetCell(x+w-1, y+h-1, '╯', borderFg, bgColor)
+		// Top and bottom
+		for i := 1; i < w-1; i++ {
+			termbox.SetCell(x+i, y, '─', borderFg, bgColor)
+			termbox.SetCell(x+i, y+h-1, '─', borderFg, bgColor)
+		}
+		// Left and right
+		for i := 1; i < h-1; i++ {
+			termbox.SetCell(x, y+i, '│', borderFg, bgColor)
+			termbox.SetCell(x+w-1, y+i, '│', borderFg, bgColor)
+		}
+		// Fill inside with background
+		for row := 1; row < h-1; row++ {
+			for col := 1; col < w-1; col++ {
+				termbox.SetCell(x+col, y+row, ' ', descFg, bgColor)
+			}
+		}
+	}
+
+	drawText := func(x, y int, text string, fg termbox.Attribute) {
+		for i, ch := range text {
+			if x+i < startX+boxWidth-1 {
+				termbox.SetCell(x+i, y, ch, fg, bgColor)
+			}
+		}
+	}
+
+	drawBox(startX, startY, boxWidth, boxHeight)
+
+	// Title
+	title := fmt.Sprintf(" CUT v%s - Keybindings ", version)
+	titleX := startX + (boxWidth-len(title))/2
+	drawText(titleX, startY, title, titleFg)
+
+	// Calculate columns
+	colWidth := (boxWidth - 4) / 3
+	if colWidth < 25 {
+		colWidth = (boxWidth - 4) / 2
+	}
+
+	// Draw sections across columns
+	col := 0
+	y := startY + 2
+	maxY := startY + boxHeight - 3
+
+	for _, section := range sections {
+		colX := startX + 2 + col*colWidth
+
+		// Check if section fits in current column
+		neededRows := 1 + len(section.entries) + 1
+		if y+neededRows > maxY && col < 2 {
+			// Move to next column
+			col++
+			colX = startX + 2 + col*colWidth
+			y = startY + 2
+		}
+
+		if y >= maxY {
+			break // No more room
+		}
+
+		drawText(colX, y, section.title, sectionFg)
+		y++
+
+		for _, entry := range section.entries {
+			if y >= maxY {
+				break
+			}
+			drawText(colX, y, fmt.Sprintf("%-12s", entry.key), keyFg)
+			drawText(colX+13, y, entry.desc, descFg)
+			y++
+		}
+		y++ // Space between sections
+	}
+
+	// Footer
+	footer := "Press any key to close"
+	footerX := startX + (boxWidth-len(footer))/2
+	drawText(footerX, startY+boxHeight-2, footer, termbox.ColorDefault|termbox.AttrDim)
+
+	termbox.Flush()
+
+	// Wait for any key
+	for {
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventKey {
+			break
+		}
+	}
+}
+
+// ClearMessage clears the status message
+func (a *App) ClearMessage() {
+	a.statusMessage = ""
+}
+
+// filterChunkResult holds the result of filtering a chunk
+type filterChunkResult struct {
+	chunkIdx int
+	indices  []int // Matching line indices in the source viewer
+}
+
+// createMatcher creates a matcher function based on search options
+// Returns matcher function and error (if regex or expression is invalid)
+func createMatcher(query string, isRegex, ignoreCase, isExpr bool) (func(line string, hasANSI bool) bool, error) {
+	if isExpr {
+		match, _, err := compileExpr(query, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		return func(line string, hasANSI bool) bool {
+			if hasANSI {
+				return match(stripANSI(line))
+			}
+			return match(line)
+		}, nil
+	} else if isRegex {
+		pattern := query
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(line string, hasANSI bool) bool {
+			if hasANSI {
+				return re.MatchString(stripANSI(line))
+			}
+			return re.MatchString(line)
+		}, nil
+	} else if ignoreCase {
+		queryLower := strings.ToLower(query)
+		return func(line string, hasANSI bool) bool {
+			if hasANSI {
+				return strings.Contains(strings.ToLower(stripANSI(line)), queryLower)
+			}
+			return strings.Contains(strings.ToLower(line), queryLower)
+		}, nil
+	}
+	return func(line string, hasANSI bool) bool {
+		if hasANSI {
+			return strings.Contains(stripANSI(line), query)
+		}
+		return strings.Contains(line, query)
+	}, nil
+}
+
+// Filter expressions (Ctrl+E in the prompt) combine terms with boolean operators:
+//
+//	ERROR and (db or cache) and not "timeout"
+//	/conn(ection)? refused/i || panic
+//	.level == "error" && .latency_ms > 500
+//
+// A term is a bare word, a quoted string or a /regex/ literal (with optional i flag)
+// and matches lines containing it. Terms next to each other are and-ed. A term starting
+// with a dot tests a field of the JSON object in the line, see field. A word like
+// dur>100ms or user=alice tests a logfmt key=value pair of the line instead.
+
+// exprTokenKind identifies a token of a filter expression
+type exprTokenKind int
+
+const (
+	exprWord   exprTokenKind = iota // Bare word
+	exprString                      // Quoted string
+	exprRegex                       // /regex/ literal
+	exprLParen                      // (
+	exprRParen                      // )
+	exprAnd                         // and, &&
+	exprOr                          // or, ||
+	exprNot                         // not, !
+	exprField                       // .field.path
+	exprKey                         // logfmt key
+	exprCompare                     // Comparison operator after a field or key
+)
+
+// keyComparePattern matches a word comparing a logfmt key, like dur>100ms or user=.
+// The key ends in a letter, digit or underscore and the value doesn't start with
+// another operator character, so arrows like a->b or x=>y stay plain words.
+var keyComparePattern = regexp.MustCompile(`^([A-Za-z_](?:[A-Za-z0-9_.\-]*[A-Za-z0-9_])?)(==|!=|<=|>=|=~|!~|=|<|>)([^=<>~!].*)?$`)
+
+// compareOps are the comparison operators accepted after a field, longest first
+var compareOps = []string{"==", "!=", "<=", ">=", "=~", "!~", "=", "<", ">"}
+
+// regexFlags are the flags a /regex/ literal accepts after its closing slash
+const regexFlags = "i"
+
+// isFieldRune reports whether ch can be part of a field name
+func isFieldRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_' || ch == '-'
+}
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string // Word, unquoted string or regex pattern
+	flags string // Regex flags after the closing slash
+}
+
+// tokenizeExpr splits a filter expression into tokens
+func tokenizeExpr(query string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '(':
+			tokens = append(tokens, exprToken{kind: exprLParen})
+			i++
+		case ch == ')':
+			tokens = append(tokens, exprToken{kind: exprRParen})
+			i++
+		case ch == '!':
+			tokens = append(tokens, exprToken{kind: exprNot})
+			i++
+		case ch == '.' && i+1 < len(runes) && isFieldRune(runes[i+1]):
+			// Field path like .a.b[0], then an optional comparison operator
+			j := i + 1
+			for j < len(runes) && (isFieldRune(runes[j]) || strings.ContainsRune(".[]", runes[j])) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: exprField, text: string(runes[i+1 : j])})
+			for j < len(runes) && unicode.IsSpace(runes[j]) {
+				j++
+			}
+			for _, op := range compareOps {
+				if strings.HasPrefix(string(runes[j:]), op) {
+					tokens = append(tokens, exprToken{kind: exprCompare, text: op})
+					j += len(op)
+					break
+				}
+			}
+			i = j
+		case ch == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			tokens = append(tokens, exprToken{kind: exprAnd})
+			i += 2
+		case ch == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, exprToken{kind: exprOr})
+			i += 2
+		case ch == '"' || ch == '\'' || ch == '/':
+			// Quoted string or regex, a backslash escapes the closing character
+			var text []rune
+			j := i + 1
+			for ; j < len(runes) && runes[j] != ch; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == ch {
+					j++
+				} else if runes[j] == '\\' && j+1 < len(runes) && ch != '/' {
+					// Keep other escapes in strings as typed, regexes handle their own
+					text = append(text, runes[j])
+					j++
+				}
+				text = append(text, runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("missing closing %c", ch)
+			}
+			j++
+			if ch != '/' {
+				tokens = append(tokens, exprToken{kind: exprString, text: string(text)})
+				i = j
+				break
+			}
+			flagStart := j
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()\"'&|", runes[j]) {
+				j++
+			}
+			flags := string(runes[flagStart:j])
+			if strings.Trim(flags, regexFlags) != "" {
+				// Not followed by flags, so a word with slashes like /api/v1
+				j = i
+				for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()\"'", runes[j]) {
+					j++
+				}
+				tokens = append(tokens, exprToken{kind: exprWord, text: string(runes[i:j])})
+				i = j
+				break
+			}
+			tokens = append(tokens, exprToken{kind: exprRegex, text: string(text), flags: flags})
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()\"'", runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if m := keyComparePattern.FindStringSubmatch(word); m != nil {
+				// The value follows the operator, or is the next token (user="alice smith", msg=~/x/)
+				tokens = append(tokens, exprToken{kind: exprKey, text: m[1]}, exprToken{kind: exprCompare, text: m[2]})
+				if strings.HasPrefix(m[3], "/") {
+					j = i + len([]rune(m[1]+m[2]))
+				} else if m[3] != "" {
+					tokens = append(tokens, exprToken{kind: exprWord, text: m[3]})
+				}
+				i = j
+				break
+			}
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, exprToken{kind: exprAnd})
+			case "or":
+				tokens = append(tokens, exprToken{kind: exprOr})
+			case "not":
+				tokens = append(tokens, exprToken{kind: exprNot})
+			default:
+				tokens = append(tokens, exprToken{kind: exprWord, text: word})
+			}
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// exprLine is a line being matched against an expression, derived forms are computed on first use
+type exprLine struct {
+	text       string
+	lower      string
+	lowered    bool
+	json       map[string]any
+	jsonParsed bool
+	logfmt     map[string]string
+}
+
+// Logfmt returns the key=value pairs of the line (none if it has an unterminated quote)
+func (l *exprLine) Logfmt() map[string]string {
+	if l.logfmt == nil {
+		fields, err := parseLogfmt(l.text)
+		if err != nil {
+			fields = map[string]string{}
+		}
+		l.logfmt = fields
+	}
+	return l.logfmt
+}
+
+// JSON returns the JSON object in the line (nil if there is none)
+func (l *exprLine) JSON() map[string]any {
+	if !l.jsonParsed {
+		l.json = parseJSONObject(l.text)
+		l.jsonParsed = true
+	}
+	return l.json
+}
+
+// Lower returns the line in lower case
+func (l *exprLine) Lower() string {
+	if !l.lowered {
+		l.lower = strings.ToLower(l.text)
+		l.lowered = true
+	}
+	return l.lower
+}
+
+// exprParser compiles filter expression tokens into a matcher by recursive descent:
+//
+//	or   := and { ("or" | "||") and }
+//	and  := not { ["and" | "&&"] not }
+//	not  := ("not" | "!") not | term | "(" or ")"
+type exprParser struct {
+	tokens     []exprToken
+	pos        int
+	ignoreCase bool
+	negated    bool     // Inside an odd number of nots
+	highlights []string // Patterns of the terms a matching line contains, for search highlighting
+}
+
+// compileExpr compiles a filter expression into a matcher on plain text lines.
+// The returned pattern highlights the terms that make a line match ("" if there are none).
+func compileExpr(query string, ignoreCase bool) (func(line string) bool, string, error) {
+	tokens, err := tokenizeExpr(query)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", fmt.Errorf("empty expression")
+	}
+	p := &exprParser{tokens: tokens, ignoreCase: ignoreCase}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, "", err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, "", fmt.Errorf("unexpected %s", p.describe(p.tokens[p.pos]))
+	}
+
+	highlight := strings.Join(p.highlights, "|")
+	return func(line string) bool {
+		return match(&exprLine{text: line})
+	}, highlight, nil
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return exprToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// describe names a token for error messages
+func (p *exprParser) describe(t exprToken) string {
+	switch t.kind {
+	case exprLParen:
+		return `"("`
+	case exprRParen:
+		return `")"`
+	case exprAnd:
+		return `"and"`
+	case exprOr:
+		return `"or"`
+	case exprNot:
+		return `"not"`
+	case exprField:
+		return strconv.Quote("." + t.text)
+	case exprCompare:
+		return strconv.Quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+func (p *exprParser) parseOr() (func(l *exprLine) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != exprOr {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(line *exprLine) bool { return l(line) || right(line) }
+	}
+}
+
+func (p *exprParser) parseAnd() (func(l *exprLine) bool, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == exprOr || t.kind == exprRParen {
+			return left, nil
+		}
+		// "and" is optional between terms
+		if t.kind == exprAnd {
+			p.pos++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(line *exprLine) bool { return l(line) && right(line) }
+	}
+}
+
+func (p *exprParser) parseNot() (func(l *exprLine) bool, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	switch t.kind {
+	case exprNot:
+		p.pos++
+		p.negated = !p.negated
+		inner, err := p.parseNot()
+		p.negated = !p.negated
+		if err != nil {
+			return nil, err
+		}
+		return func(line *exprLine) bool { return !inner(line) }, nil
+	case exprLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != exprRParen {
+			return nil, fmt.Errorf(`missing ")"`)
+		}
+		p.pos++
+		return inner, nil
+	case exprWord, exprString, exprRegex:
+		p.pos++
+		return p.term(t)
+	case exprField:
+		p.pos++
+		return p.field(t)
+	case exprKey:
+		p.pos++
+		return p.key(t)
+	}
+	return nil, fmt.Errorf("unexpected %s", p.describe(t))
+}
+
+// term compiles a word, string or regex into a matcher
+func (p *exprParser) term(t exprToken) (func(l *exprLine) bool, error) {
+	if t.kind == exprRegex {
+		re, err := p.regex(t)
+		if err != nil {
+			return nil, err
+		}
+		p.highlight(re.String())
+		return func(line *exprLine) bool { return re.MatchString(line.text) }, nil
+	}
+
+	text := t.text
+	if p.ignoreCase {
+		p.highlight("(?i)" + regexp.QuoteMeta(text))
+		lower := strings.ToLower(text)
+		return func(line *exprLine) bool { return strings.Contains(line.Lower(), lower) }, nil
+	}
+	p.highlight(regexp.QuoteMeta(text))
+	return func(line *exprLine) bool { return strings.Contains(line.text, text) }, nil
+}
+
+// regex compiles a regex literal, or a string used as one
+func (p *exprParser) regex(t exprToken) (*regexp.Regexp, error) {
+	pattern := t.text
+	for _, flag := range t.flags {
+		if !strings.ContainsRune(regexFlags, flag) {
+			return nil, fmt.Errorf("unknown regex flag %q", flag)
+		}
+	}
+	if p.ignoreCase || t.flags != "" {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// field compiles a JSON field test. ".path" alone checks that the field exists,
+// ".path op value" compares it: numerically if value is an unquoted number or
+// duration, as text otherwise; =~ and !~ match it against a regex. Array elements are
+// addressed by index (.items[0].id).
+func (p *exprParser) field(t exprToken) (func(l *exprLine) bool, error) {
+	path := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(t.text), ".")
+	op, ok := p.peek()
+	if !ok || op.kind != exprCompare {
+		return func(line *exprLine) bool {
+			_, ok := lookupJSON(line.JSON(), path)
+			return ok
+		}, nil
+	}
+	p.pos++
+
+	test, err := p.comparison(op.text)
+	if err != nil {
+		return nil, err
+	}
+	return func(line *exprLine) bool {
+		value, ok := lookupJSON(line.JSON(), path)
+		return ok && test(jsonText(value))
+	}, nil
+}
+
+// comparison compiles the value after a comparison operator into a test on field text
+func (p *exprParser) comparison(op string) (func(text string) bool, error) {
+	value, ok := p.peek()
+	if !ok || (value.kind != exprWord && value.kind != exprString && value.kind != exprRegex) {
+		return nil, fmt.Errorf("missing value after %s", op)
+	}
+	p.pos++
+
+	if op == "=~" || op == "!~" {
+		re, err := p.regex(value)
+		if err != nil {
+			return nil, err
+		}
+		want := op == "=~"
+		return func(text string) bool { return re.MatchString(text) == want }, nil
+	}
+	if value.kind == exprRegex {
+		return nil, fmt.Errorf("use =~ or !~ to match a regex")
+	}
+
+	// Unquoted numbers and durations (100ms, 1.5s) compare numerically
+	if num, err := strconv.ParseFloat(value.text, 64); err == nil && value.kind == exprWord {
+		return func(text string) bool {
+			n, err := strconv.ParseFloat(text, 64)
+			return err == nil && compareResult(cmp.Compare(n, num), op)
+		}, nil
+	}
+	if dur, err := time.ParseDuration(value.text); err == nil && value.kind == exprWord {
+		return func(text string) bool {
+			d, err := time.ParseDuration(text)
+			return err == nil && compareResult(cmp.Compare(d, dur), op)
+		}, nil
+	}
+	want := value.text
+	if p.ignoreCase {
+		want = strings.ToLower(want)
+		return func(text string) bool { return compareResult(strings.Compare(strings.ToLower(text), want), op) }, nil
+	}
+	return func(text string) bool { return compareResult(strings.Compare(text, want), op) }, nil
+}
+
+// compareResult reports whether the result of a three-way comparison satisfies op
+func compareResult(c int, op string) bool {
+	switch op {
+	case "==", "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// key compiles a comparison of a logfmt key of the line (see field for the operators)
+func (p *exprParser) key(t exprToken) (func(l *exprLine) bool, error) {
+	op := p.tokens[p.pos]
+	p.pos++
+	test, err := p.comparison(op.text)
+	if err != nil {
+		return nil, err
+	}
+	return func(line *exprLine) bool {
+		value, ok := line.Logfmt()[t.text]
+		return ok && test(value)
+	}, nil
+}
+
+// highlight records the pattern of a term a matching line contains
+func (p *exprParser) highlight(pattern string) {
+	if !p.negated {
+		p.highlights = append(p.highlights, "(?:"+pattern+")")
+	}
+}
+
+// invalidQueryMessage describes a query that failed to compile
+func invalidQueryMessage(isExpr bool, err error) string {
+	if isExpr {
+		return "Invalid expression: " + err.Error()
+	}
+	return "Invalid regex: " + err.Error()
+}
+
+// contextFlagPattern matches a grep style context flag (-A 2, -B5, -C 3) before a keep query
+var contextFlagPattern = regexp.MustCompile(`^-([ABC]) ?(\d+)\s+`)
+
+// parseContextFlags strips leading -A/-B/-C flags from a keep query, returning the
+// query and the number of context lines before and after each match
+func parseContextFlags(query string) (string, int, int) {
+	before, after := 0, 0
+	for {
+		m := contextFlagPattern.FindStringSubmatch(query)
+		if m == nil {
+			return query, before, after
+		}
+		n, _ := strconv.Atoi(m[2])
+		switch m[1] {
+		case "A":
+			after = n
+		case "B":
+			before = n
+		case "C":
+			before, after = n, n
+		}
+		query = query[len(m[0]):]
+	}
+}
+
+// endsGroup reports whether line i of a view with context lines is followed by a gap
+// in its parent, so a separator is drawn below it
+func (v *Viewer) endsGroup(i int) bool {
+	if v.before == 0 && v.after == 0 {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return i+1 < len(v.originIndices) && v.originIndices[i+1] != v.originIndices[i]+1
+}
+
+// filterSpec records how a filtered view was made, so the filter stack panel can show
+// it, edit it and make the view again
+type filterSpec struct {
+	op         byte   // '&', '-', '+', 'T', '!' or 'D'
+	query      string // As typed (with context flags for '&', from..to for 'T', a level for '!')
+	isRegex    bool
+	ignoreCase bool
+	isExpr     bool
+	disabled   bool         // Lines pass through unfiltered
+	lines      map[int]bool // Lines of the original a diff result keeps ('D', query describes it)
+}
+
+// HandleFilter filters lines based on query
+// If keep is true (&), keeps matching lines; if false (-), excludes matching lines
+func (a *App) HandleFilter(keep bool) {
+	prompt := "&"
+	if !keep {
+		prompt = "-"
+	}
+
+	query, isRegex, ignoreCase, isExpr, ok := a.promptWithModifiers(prompt)
+	if ok && query != "" {
+		a.pushFilter(&filterSpec{op: prompt[0], query: query, isRegex: isRegex, ignoreCase: ignoreCase, isExpr: isExpr})
+	}
+}
+
+// HandleFilterAppend appends matching lines from original
+func (a *App) HandleFilterAppend() {
+	query, isRegex, ignoreCase, isExpr, ok := a.promptWithModifiers("+")
+	if ok && query != "" {
+		a.pushFilter(&filterSpec{op: '+', query: query, isRegex: isRegex, ignoreCase: ignoreCase, isExpr: isExpr})
+	}
+}
+
+// pushFilter pushes the view spec makes of the current view
+func (a *App) pushFilter(spec *filterSpec) {
+	current := a.stack.Current()
+	newViewer, err := a.newFilterView(current, spec, current.topLine)
+	if err != nil {
+		a.ShowTempMessage(err.Error())
+		return
+	}
+	a.stack.Push(newViewer)
+	a.search.Clear()
+}
+
+// newFilterView creates the view spec makes of current and starts filtering into it in
+// the background. The view opens at the first line at or after line topLine of current.
+// It stays subscribed to its parent, so lines appended while following are filtered too.
+func (a *App) newFilterView(current *Viewer, spec *filterSpec, topLine int) (*Viewer, error) {
+	if spec.disabled {
+		// Every line passes, so the steps after it see the same lines
+		newViewer := &Viewer{
+			parent:   current,
+			loading:  true,
+			filename: current.filename,
+			match:    func(string, bool) bool { return true },
+			filter:   spec,
+		}
+		current.subscribe(newViewer)
+		go newViewer.filterLines(current.Snapshot(), topLine)
+		return newViewer, nil
+	}
+
+	switch spec.op {
+	case '+':
+		return a.newAppendView(current, spec, topLine)
+	case 'T':
+		return a.newTimeRangeView(current, spec, topLine)
+	case '!':
+		return a.newLevelView(current, spec, topLine)
+	case 'D':
+		return a.newLinesView(current, spec, topLine)
+	}
+
+	src := current.Snapshot() // Get snapshot for thread-safety
+
+	// Keep filters take grep style context flags before the query
+	query, before, after := spec.query, 0, 0
+	keep := spec.op == '&'
+	if keep {
+		query, before, after = parseContextFlags(query)
+	}
+	root := current.root()
+	records := root.records.forSource(root.Snapshot(), a.timestampFormat)
+
+	matcher, err := createMatcher(query, spec.isRegex, spec.ignoreCase, spec.isExpr)
+	if err != nil {
+		return nil, fmt.Errorf("%s", invalidQueryMessage(spec.isExpr, err))
+	}
+	match := func(line string, hasANSI bool) bool {
+		return matcher(line, hasANSI) == keep
+	}
+
+	// Create new viewer immediately with loading state
+	newViewer := &Viewer{
+		parent:   current,
+		loading:  true,
+		filename: current.filename,
+		topLine:  0,
+		leftCol:  0,
+		match:    match,
+		before:   before,
+		after:    after,
+		records:  records,
+		filter:   spec,
+	}
+	current.subscribe(newViewer)
+	go newViewer.filterLines(src, topLine)
+	return newViewer, nil
+}
+
+// filterLines runs the lines of src (a snapshot of the parent) through match in
+// parallel and streams the results into the loading view v
+func (v *Viewer) filterLines(src lineSource, topLine int) {
+	match, records := v.match, v.records
+	before, after := v.before, v.after
+
+	numWorkers := 8
+	totalLines := src.Len()
+	if totalLines == 0 {
+		// The parent is still loading, its lines come in through update
+		v.finishLoading(0)
+		return
+	}
+	if totalLines < numWorkers {
+		numWorkers = 1
+	}
+	chunkSize := (totalLines + numWorkers - 1) / numWorkers
+
+	resultChan := make(chan filterChunkResult, numWorkers)
+
+	// Start workers, fewer than numWorkers when the chunks run out early
+	started := 0
+	for w := 0; w < numWorkers; w++ {
+		start := w * chunkSize
+		end := start + chunkSize
+		if end > totalLines {
+			end = totalLines
+		}
+		if start >= totalLines {
+			break
+		}
+		started++
+
+		go func(chunkIdx, start, end int) {
+			var chunkIndices []int
+			if records != nil {
+				// Every line of a matching record matches
+				records.forEachRecord(src, start, end, func(recStart, recEnd int) {
+					if match(recordText(src, recStart, recEnd)) {
+						for i := recStart; i < recEnd; i++ {
+							chunkIndices = append(chunkIndices, i)
+						}
+					}
+				})
+				resultChan <- filterChunkResult{chunkIdx, chunkIndices}
+				return
+			}
+			for i := start; i < end; i++ {
+				if match(src.Line(i), src.HasANSI(i)) {
+					chunkIndices = append(chunkIndices, i)
+				}
+			}
+			resultChan <- filterChunkResult{chunkIdx, chunkIndices}
+		}(w, start, end)
+	}
+
+	// Collect results in order
+	results := make([]filterChunkResult, numWorkers)
+	for i := 0; i < started; i++ {
+		result := <-resultChan
+		results[result.chunkIdx] = result
+	}
+	close(resultChan)
+
+	// Merge results in order and stream to viewer
+	foundMatch := false
+	matchesBefore := 0
+	lineCount := 0
+	last := -1
+
+	for chunkIdx := 0; chunkIdx < numWorkers; chunkIdx++ {
+		chunk := results[chunkIdx]
+		for _, matchIdx := range chunk.indices {
+			// Add the match with its context lines that aren't shown yet
+			for origIdx := max(matchIdx-before, last+1); origIdx <= min(matchIdx+after, totalLines-1); origIdx++ {
+				v.mu.Lock()
+				v.originIndices = append(v.originIndices, origIdx)
+				v.mu.Unlock()
+				last = origIdx
+
+				if origIdx >= topLine && !foundMatch {
+					foundMatch = true
+					v.topLine = matchesBefore
+				}
+				if !foundMatch {
+					matchesBefore++
+				}
+
+				lineCount++
+				if lineCount <= 100 || lineCount%1000 == 0 {
+					termbox.Interrupt()
+				}
+			}
+			// Lines after the snapshot still owe context to the last match
+			v.trailing = max(matchIdx+after-(totalLines-1), 0)
+		}
+	}
+	v.trackLastRecord(src)
+	v.finishLoading(totalLines)
+}
+
+// finishLoading ends the initial filter pass over the first scanned lines of the parent
+// and catches up with lines the parent got meanwhile
+func (v *Viewer) finishLoading(scanned int) {
+	v.mu.Lock()
+	v.scanned = scanned
+	v.loading = false
+	v.mu.Unlock()
+	v.update()
+	// Views filtered from this one while it was loading only saw part of it
+	v.notifyChildren()
+	termbox.Interrupt()
+}
+
+// newAppendView creates a view of the original viewer with the lines of current plus
+// the original lines matching the query of spec
+func (a *App) newAppendView(current *Viewer, spec *filterSpec, topLine int) (*Viewer, error) {
+	currentLine := current.GetLine(topLine)
+	original := current.root()
+	originalSrc := original.Snapshot()
+	records := original.records.forSource(originalSrc, a.timestampFormat)
+
+	matcher, err := createMatcher(spec.query, spec.isRegex, spec.ignoreCase, spec.isExpr)
+	if err != nil {
+		return nil, fmt.Errorf("%s", invalidQueryMessage(spec.isExpr, err))
+	}
+
+	// Create new viewer immediately with loading state
+	// Its lines come straight from the original, so that's what originIndices point into.
+	// New lines of the original are kept if current shows them (it's updated first) or
+	// they match.
+	newViewer := &Viewer{
+		parent:   original,
+		loading:  true,
+		filename: current.filename,
+		topLine:  0,
+		leftCol:  0,
+		match:    matcher,
+		base:     current,
+		records:  records,
+		filter:   spec,
+	}
+	original.subscribe(newViewer)
+
+	// Process in parallel
+	go func() {
+		// A filtered current view may still be loading after the filter stack was rebuilt
+		for current.parent != nil && current.IsLoading() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, shown := rootIndices(current.Snapshot())
+
+		// Parallel filtering of original lines
+		numWorkers := 8
+		totalLines := originalSrc.Len()
+		if totalLines == 0 {
+			newViewer.finishLoading(0)
+			return
+		}
+		if totalLines < numWorkers {
+			numWorkers = 1
+		}
+		chunkSize := (totalLines + numWorkers - 1) / numWorkers
+
+		resultChan := make(chan filterChunkResult, numWorkers)
+
+		// Mark the original lines current shows
+		inCurrent := make([]bool, totalLines)
+		for _, idx := range shown {
+			if idx < totalLines {
+				inCurrent[idx] = true
+			}
+		}
+
+		// Start workers - each checks if line is in current OR matches query
+		started := 0
+		for w := 0; w < numWorkers; w++ {
+			start := w * chunkSize
+			end := start + chunkSize
+			if end > totalLines {
+				end = totalLines
+			}
+			if start >= totalLines {
+				break
+			}
+			started++
+
+			go func(chunkIdx, start, end int) {
+				var chunkIndices []int
+				if records != nil {
+					// Whole records that current shows a line of or that match
+					records.forEachRecord(originalSrc, start, end, func(recStart, recEnd int) {
+						keep := false
+						for i := recStart; i < recEnd && !keep; i++ {
+							keep = inCurrent[i]
+						}
+						if keep || matcher(recordText(originalSrc, recStart, recEnd)) {
+							for i := recStart; i < recEnd; i++ {
+								chunkIndices = append(chunkIndices, i)
+							}
+						}
+					})
+					resultChan <- filterChunkResult{chunkIdx, chunkIndices}
+					return
+				}
+				for i := start; i < end; i++ {
+					if inCurrent[i] || matcher(originalSrc.Line(i), originalSrc.HasANSI(i)) {
+						chunkIndices = append(chunkIndices, i)
+					}
+				}
+				resultChan <- filterChunkResult{chunkIdx, chunkIndices}
+			}(w, start, end)
+		}
+
+		// Collect results in order
+		results := make([]filterChunkResult, numWorkers)
+		for i := 0; i < started; i++ {
+			result := <-resultChan
+			results[result.chunkIdx] = result
+		}
+		close(resultChan)
+
+		// Merge results in order and stream to viewer
+		foundCurrentLine := false
+		lineCount := 0
+
+		for chunkIdx := 0; chunkIdx < numWorkers; chunkIdx++ {
+			chunk := results[chunkIdx]
+			for _, origIdx := range chunk.indices {
+				newViewer.mu.Lock()
+				newViewer.originIndices = append(newViewer.originIndices, origIdx)
+				if !foundCurrentLine && originalSrc.Line(origIdx) == currentLine {
+					foundCurrentLine = true
+					newViewer.topLine = len(newViewer.originIndices) - 1
+				}
+				newViewer.mu.Unlock()
+
+				lineCount++
+				if lineCount <= 100 || lineCount%1000 == 0 {
+					termbox.Interrupt()
+				}
+			}
+		}
+		newViewer.trackLastRecord(originalSrc)
+		newViewer.finishLoading(totalLines)
+	}()
+	return newViewer, nil
+}
+
+// String returns the filter as shown in the filter stack panel
+func (f *filterSpec) String() string {
+	s := string(f.op) + " "
+	if f.isRegex {
+		s += "[regex] "
+	}
+	if f.ignoreCase {
+		s += "[nocase] "
+	}
+	if f.isExpr {
+		s += "[expr] "
+	}
+	return s + f.query
+}
+
+// rebuildStack replaces the views from index from on with views made from specs, the
+// filters of viewers[1:] after a change. If the first view to make fails the stack is
+// left alone. Later filters that no longer apply are turned off and returned.
+func (a *App) rebuildStack(from int, specs []*filterSpec) ([]string, error) {
+	old := a.stack.viewers[from:]
+	views := append([]*Viewer(nil), a.stack.viewers[:from]...)
+	var failed []string
+	for i := from; i <= len(specs); i++ {
+		spec := specs[i-1]
+		v, err := a.newFilterView(views[i-1], spec, 0)
+		if err != nil && i == from {
+			return nil, err
+		}
+		if err != nil {
+			failed = append(failed, spec.String())
+			spec.disabled = true
+			v, _ = a.newFilterView(views[i-1], spec, 0)
+		}
+		views = append(views, v)
+	}
+
+	// The new path replaces the old one in the tree. The other branches of the views it
+	// replaces were filtered from them, so they're made again on the new views. Those of
+	// a deleted filter's view go with it.
+	deleted := len(old) - (len(views) - from)
+	for i := from; i < len(views); i++ {
+		replaced := old[i-from+deleted]
+		var path, oldPath *Viewer
+		if i+1 < len(views) {
+			path, oldPath = views[i+1], old[i-from+deleted+1]
+		}
+		views[i].keepDisplayModes(replaced)
+		a.remakeBranches(views[i], replaced, path, oldPath)
+	}
+	views[from-1].replaceBranch(old[0], views[from])
+	a.stack.viewers = views
+	a.search.Clear()
+	return failed, nil
+}
+
+// remakeBranches gives v, made again in place of old, the branches of old: path (the next
+// view of the stack, nil past its top) takes the place of oldPath and the other branches
+// are made again on v. Branches that can't be made again are dropped.
+func (a *App) remakeBranches(v, old, path, oldPath *Viewer) {
+	v.branches, v.visited = nil, 0
+	for i, b := range old.branches {
+		if b == oldPath {
+			b = path
+		} else if b = a.remakeView(v, b); b == nil {
+			continue
+		}
+		// The stack goes on through path, past its top the branch shown last is kept
+		if b == path || path == nil && i == old.visited {
+			v.visited = len(v.branches)
+		}
+		v.branches = append(v.branches, b)
+	}
+}
+
+// remakeView makes old again filtered from parent, along with every view filtered from it.
+// Returns nil if its filter fails on parent.
+func (a *App) remakeView(parent, old *Viewer) *Viewer {
+	v, err := a.newFilterView(parent, old.filter, 0)
+	if err != nil {
+		return nil
+	}
+	v.keepDisplayModes(old)
+	a.remakeBranches(v, old, nil, nil)
+	return v
+}
+
+// keepDisplayModes gives v, made again in place of old, the display modes of old
+func (v *Viewer) keepDisplayModes(old *Viewer) {
+	v.wordWrap = old.wordWrap
+	v.jsonPretty = old.jsonPretty
+	v.showLineNumbers = old.showLineNumbers
+	v.stickyLeft = old.stickyLeft
+}
+
+// HandleFilterStack shows the filters of the stack in a panel where any of them can be
+// edited, turned off, moved or deleted. The views after a changed filter are made again.
+func (a *App) HandleFilterStack() {
+	selected := len(a.stack.viewers) - 1
+	message := ""
+	for {
+		a.drawFilterStack(selected, message)
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue // Line counts are redrawn as views load
+		}
+
+		specs := make([]*filterSpec, 0, len(a.stack.viewers)-1)
+		for _, v := range a.stack.viewers[1:] {
+			specs = append(specs, v.filter)
+		}
+		// Where to rebuild the stack from (0 if nothing changed) and the selection after it
+		var spec *filterSpec
+		from, next := 0, selected
+		if selected > 0 {
+			spec = specs[selected-1]
+		}
+
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'S':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, len(a.stack.viewers)-1)
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case spec == nil:
+			// The original file can't be changed
+		case ev.Key == termbox.KeyEnter || ev.Ch == 'e':
+			edited := *spec
+			a.Draw()
+			var ok bool
+			switch spec.op {
+			case 'T':
+				edited.query, ok = a.stack.Current().editInput("T (time range from..to): ", spec.query)
+			case '!':
+				edited.query, ok = a.stack.Current().editInput("! (level at least): ", spec.query)
+			case 'D':
+				message = "Diff results can't be edited"
+				continue
+			default:
+				edited.query, edited.isRegex, edited.ignoreCase, edited.isExpr, ok = a.editWithModifiers(
+					string(spec.op), spec.query, spec.isRegex, spec.ignoreCase, spec.isExpr)
+			}
+			if !ok || edited.query == "" {
+				continue
+			}
+			specs[selected-1] = &edited
+			from = selected
+		case ev.Key == termbox.KeySpace:
+			toggled := *spec
+			toggled.disabled = !toggled.disabled
+			specs[selected-1] = &toggled
+			from = selected
+		case ev.Ch == 'J' && selected < len(specs):
+			specs[selected-1], specs[selected] = specs[selected], specs[selected-1]
+			from, next = selected, selected+1
+		case ev.Ch == 'K' && selected > 1:
+			specs[selected-2], specs[selected-1] = specs[selected-1], specs[selected-2]
+			from, next = selected-1, selected-1
+		case ev.Ch == 'd' || ev.Ch == 'x':
+			specs = append(specs[:selected-1], specs[selected:]...)
+			from, next = selected, min(selected, len(specs))
+		}
+
+		if from == 0 {
+			continue
+		}
+		message = ""
+		if from > len(specs) {
+			// The last filter was deleted
+			a.moveInTree(a.stack.Remove)
+		} else if failed, err := a.rebuildStack(from, specs); err != nil {
+			message = err.Error()
+			continue
+		} else if len(failed) > 0 {
+			message = "Turned off: " + strings.Join(failed, ", ")
+		}
+		selected = next
+	}
+}
+
+// viewDescription names a view: its filter, or the file for the original view
+func viewDescription(v *Viewer) string {
+	if v.filter != nil {
+		return v.filter.String()
+	}
+	return v.filename
+}
+
+// drawFilterStack draws the filter stack panel over the current view
+func (a *App) drawFilterStack(selected int, message string) {
+	rows := make([]panelRow, len(a.stack.viewers))
+	for i, v := range a.stack.viewers {
+		info := fmt.Sprintf("%d lines", v.LineCount())
+		if v.IsLoading() {
+			info += " [loading...]"
+		}
+		if v.filter != nil && v.filter.disabled {
+			info += " [off]"
+		}
+		rows[i] = panelRow{text: fmt.Sprintf("%2d  %s", i, viewDescription(v)), info: info}
+	}
+
+	footer := "e:edit  space:on/off  J/K:move  d:delete  q:close"
+	if message != "" {
+		footer = message
+	}
+	a.drawPanel("Filter stack", rows, selected, footer)
+}
+
+// panelRow is a row of a list panel
+type panelRow struct {
+	text   string
+	info   string            // Right aligned
+	fg, bg termbox.Attribute // Colors of text when the row isn't selected
+}
+
+// drawPanel draws a list panel over the current view, with the selected row inverted
+func (a *App) drawPanel(title string, rows []panelRow, selected int, footer string) {
+	a.Draw()
+	width, height := termbox.Size()
+	boxWidth := min(max(width*3/4, 40), width)
+	boxHeight := min(max(len(rows), 1)+5, height)
+	startX, startY, drawText := drawBox(title, boxWidth, boxHeight)
+	bgColor := termbox.ColorDefault
+
+	// Keep the selected row in view
+	visible := boxHeight - 4
+	first := max(selected-visible+1, 0)
+	for i := first; i < len(rows) && i < first+visible; i++ {
+		row := rows[i]
+		y := startY + 2 + i - first
+		fg, bg := row.fg, row.bg
+		if i == selected {
+			fg, bg = termbox.ColorBlack, termbox.ColorWhite
+		}
+		x := drawText(startX+2, y, row.text, fg, bg)
+		if i == selected {
+			fg, bg = termbox.ColorBlack, termbox.ColorWhite
+		} else {
+			fg, bg = termbox.ColorDefault, bgColor
+		}
+		infoX := max(startX+boxWidth-2-len([]rune(row.info)), x+1)
+		for ; x < infoX && i == selected; x++ {
+			termbox.SetCell(x, y, ' ', fg, bg)
+		}
+		drawText(infoX, y, row.info, fg, bg)
+	}
+	if len(rows) == 0 {
+		drawText(startX+2, startY+2, "(none)", termbox.ColorDefault|termbox.AttrDim, bgColor)
+	}
+
+	drawText(startX+2, startY+boxHeight-2, footer, termbox.ColorDefault|termbox.AttrDim, bgColor)
+	termbox.Flush()
+}
+
+// drawBox draws an empty panel with a title in the middle of the screen. It returns
+// the top left corner and a function drawing text clipped to the panel, which returns
+// the column after the text.
+func drawBox(title string, boxWidth, boxHeight int) (int, int, func(x, y int, text string, fg, bg termbox.Attribute) int) {
+	width, height := termbox.Size()
+	startX := (width - boxWidth) / 2
+	startY := (height - boxHeight) / 2
+
+	borderFg := termbox.ColorCyan
+	bgColor := termbox.ColorDefault
+	for y := startY; y < startY+boxHeight; y++ {
+		for x := startX; x < startX+boxWidth; x++ {
+			ch := ' '
+			switch {
+			case y == startY && x == startX:
+				ch = '╭'
+			case y == startY && x == startX+boxWidth-1:
+				ch = '╮'
+			case y == startY+boxHeight-1 && x == startX:
+				ch = '╰'
+			case y == startY+boxHeight-1 && x == startX+boxWidth-1:
+				ch = '╯'
+			case y == startY || y == startY+boxHeight-1:
+				ch = '─'
+			case x == startX || x == startX+boxWidth-1:
+				ch = '│'
+			}
+			termbox.SetCell(x, y, ch, borderFg, bgColor)
+		}
+	}
+
+	drawText := func(x, y int, text string, fg, bg termbox.Attribute) int {
+		for _, ch := range text {
+			if x >= startX+boxWidth-1 {
+				break
+			}
+			termbox.SetCell(x, y, ch, fg, bg)
+			x++
+		}
+		return x
+	}
+	drawText(startX+2, startY, " "+title+" ", termbox.ColorYellow|termbox.AttrBold, bgColor)
+	return startX, startY, drawText
+}
+
+// HandleGotoLine prompts for a line number and jumps to it
+func (a *App) HandleGotoLine() {
+	current := a.stack.Current()
+	input, ok := current.promptForInput(":")
+	if ok && input != "" {
+		lineNum, err := strconv.Atoi(input)
+		if err != nil {
+			a.ShowTempMessage("Invalid line number")
+			return
+		}
+		// Convert to 0-based index
+		lineIdx := lineNum - 1
+		if lineIdx < 0 {
+			lineIdx = 0
+		}
+		maxLine := current.LineCount() - 1
+		if lineIdx > maxLine {
+			lineIdx = maxLine
+		}
+		current.topLine = lineIdx
+	}
+}
+
+// writeLines writes the lines of src to filename, separated by newlines. Lines with a
+// note (notes are by root line) are followed by an indented line with it.
+func writeLines(filename string, src lineSource, notes map[int]string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var roots []int
+	if len(notes) > 0 {
+		_, roots = rootIndices(src)
+	}
+	w := bufio.NewWriter(file)
+	for i := 0; i < src.Len(); i++ {
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+		w.WriteString(src.Line(i))
+		if roots == nil {
+			continue
+		}
+		if note, ok := notes[roots[i]]; ok {
+			w.WriteString("\n  [note] " + note)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// HandleExport saves the current filtered view to a file
+func (a *App) HandleExport() {
+	current := a.stack.Current()
+	filename, ok := current.promptForInput(";")
+	if !ok || filename == "" {
+		return
+	}
+
+	// Stream lines out instead of joining them, views of mapped files can be huge
+	src := current.Snapshot()
+	if root := a.stack.viewers[0].root(); root.records != nil && current != root {
+		src = root.records.forSource(root.Snapshot(), a.timestampFormat).wholeRecords(src)
+	}
+	err := writeLines(filename, src, a.stack.viewers[0].root().notes)
+	if err != nil {
+		a.ShowTempMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	a.ShowTempMessage(fmt.Sprintf("Saved %d lines to %s", src.Len(), filename))
+}
+
+// HandleStickyLeft prompts for the number of sticky left columns
+func (a *App) HandleStickyLeft() {
+	current := a.stack.Current()
+	input, ok := current.promptForInput("K (sticky cols): ")
+	if !ok {
+		return
+	}
 	if input == "" {
-		a.timestampFormat = ""
-		a.ShowTempMessage("Timestamp format cleared")
+		// Empty input disables the feature
+		current.stickyLeft = 0
+		a.ShowTempMessage("Sticky left disabled")
+		return
+	}
+	num, err := strconv.Atoi(input)
+	if err != nil || num < 0 {
+		a.ShowTempMessage("Invalid number")
+		return
+	}
+	current.stickyLeft = num
+	if num > 0 {
+		a.ShowTempMessage(fmt.Sprintf("Sticky left: %d chars", num))
+	} else {
+		a.ShowTempMessage("Sticky left disabled")
+	}
+}
+
+// ToggleFollow toggles follow mode for the root viewer
+func (a *App) ToggleFollow() {
+	// Follow mode only works on the root viewer
+	root := a.stack.viewers[0].root()
+	if root.compression != "" {
+		a.ShowTempMessage("Can't follow a compressed file")
+		return
+	}
+	root.follow.Store(!root.follow.Load())
+	if root.follow.Load() {
+		// Start following if not already
+		switch {
+		case root.stream:
+			// Piped lines keep streaming in, the loader scrolls along with them
+		case root.multiFile:
+			go root.followMerged()
+		default:
+			go root.followFile(root.filename)
+		}
+		// Jump to end
+		root.goToEnd()
+		a.ShowTempMessage("Follow mode ON")
+	} else {
+		a.ShowTempMessage("Follow mode OFF")
+	}
+}
+
+// HandleSearch performs a search starting from current line
+// If backward is true, searches upward with "?" prompt; otherwise searches downward with "/" prompt
+func (a *App) HandleSearch(backward bool) {
+	current := a.stack.Current()
+	prompt := "/"
+	noMatchMsg := "EOF - no more matches"
+	if backward {
+		prompt = "?"
+		noMatchMsg = "BOF - no more matches"
+	}
+
+	query, isRegex, ignoreCase, isExpr, ok := a.promptWithModifiers(prompt)
+	if ok && query != "" {
+		if isExpr {
+			if _, _, err := compileExpr(query, ignoreCase); err != nil {
+				a.ShowTempMessage(invalidQueryMessage(isExpr, err))
+				return
+			}
+		}
+		src := current.Snapshot()
+		records := a.stack.viewers[0].root().records.forSource(src, a.timestampFormat)
+		lineIdx := a.search.Search(src, query, current.topLine, backward, isRegex, ignoreCase, isExpr, records)
+		if lineIdx >= 0 {
+			current.topLine = lineIdx
+		} else if a.search.HasResults() {
+			a.ShowTempMessage(noMatchMsg)
+		}
+	}
+}
+
+// HandleSearchNav navigates search results
+// If reverse is false (n key): continues in search direction
+// If reverse is true (N key): goes opposite to search direction
+func (a *App) HandleSearchNav(reverse bool) {
+	if !a.search.HasResults() {
+		return
+	}
+
+	current := a.stack.Current()
+	topLine := current.topLine
+
+	// Determine if we should go forward (down) or backward (up) in the file
+	goingUp := a.search.backward != reverse
+
+	if goingUp {
+		// Find the last match BEFORE topLine
+		found := false
+		for i := len(a.search.matches) - 1; i >= 0; i-- {
+			if a.search.matches[i] < topLine {
+				current.topLine = a.search.matches[i]
+				a.search.current = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.ShowTempMessage("BOF")
+		}
+	} else {
+		// Find the first match AFTER topLine
+		found := false
+		for i, lineIdx := range a.search.matches {
+			if lineIdx > topLine {
+				current.topLine = lineIdx
+				a.search.current = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.ShowTempMessage("EOF")
+		}
+	}
+}
+
+// HandleStackNav navigates the viewer stack
+// If reset is true (=), resets to first viewer; if false (U), goes down one level.
+// The views left stay in the filter tree.
+func (a *App) HandleStackNav(reset bool) {
+	if reset {
+		a.moveInTree(a.stack.Reset)
+	} else {
+		a.moveInTree(a.stack.Pop)
+	}
+	a.search.Clear()
+}
+
+// HandleBranchNav moves to the next or previous sibling branch (delta 1 or -1), or with
+// delta 0 back into the branch last left with U
+func (a *App) HandleBranchNav(delta int) {
+	move := a.stack.Reenter
+	if delta != 0 {
+		move = func() bool { return a.stack.Switch(delta) }
+	}
+	if !a.moveInTree(move) {
+		a.ShowTempMessage("No other branch")
+	}
+}
+
+// HandleBranchClose drops the current view and the views filtered from it
+func (a *App) HandleBranchClose() {
+	if a.moveInTree(a.stack.Remove) {
+		a.ShowTempMessage("Branch closed")
+	}
+}
+
+// moveInTree moves to another view of the filter tree, keeping the line at the top of
+// the screen (or the first one after it) in view. Returns false if move didn't move.
+func (a *App) moveInTree(move func() bool) bool {
+	current := a.stack.Current()
+	target := current.rootLine(current.topLine)
+	if !move() {
+		return false
+	}
+	next := a.stack.Current()
+	next.topLineOffset = 0
+	next.topLine = next.lineForRoot(target)
+	a.search.Clear()
+	return true
+}
+
+// rootLine returns the line of the root viewer shown at line i of v
+func (v *Viewer) rootLine(i int) int {
+	for ; v.parent != nil; v = v.parent {
+		indices := v.OriginIndices()
+		if len(indices) == 0 {
+			i = 0
+			continue
+		}
+		i = indices[min(i, len(indices)-1)]
+	}
+	return i
+}
+
+// lineForRoot returns the first line of v showing line target of the root or a line
+// after it, or the last line if there's none
+func (v *Viewer) lineForRoot(target int) int {
+	_, indices := rootIndices(v.Snapshot())
+	idx := sort.SearchInts(indices, target)
+	if idx >= len(indices) {
+		idx = len(indices) - 1
+	}
+	return max(idx, 0)
+}
+
+// Draw renders the panes: the current view of each with its status bar
+func (a *App) Draw() {
+	for _, p := range a.panes {
+		p.stack.viewers[0].root().attachNotes()
+	}
+	if msg := a.stack.viewers[0].root().TakeNotice(); msg != "" {
+		a.ShowTempMessage(msg)
+	}
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	rects := a.paneRects()
+	for i, p := range a.panes {
+		if i == a.active {
+			continue
+		}
+		a.drawView(p, rects[i], false)
+		dimStatusBar(p.stack.Current())
+	}
+	a.drawView(a.panes[a.active], rects[a.active], true)
+	if a.sideBySide {
+		_, height := termbox.Size()
+		for _, r := range rects[1:] {
+			for y := 0; y < height; y++ {
+				termbox.SetCell(r.x-1, y, '│', termbox.ColorDefault|termbox.AttrDim, termbox.ColorDefault)
+			}
+		}
+	}
+	termbox.Flush()
+}
+
+// drawView renders the current view of pane p with its status bar in a part of the
+// screen. Only the active pane shows messages, the visual selection and the tabs.
+func (a *App) drawView(p *pane, r paneRect, active bool) {
+	current := p.stack.Current()
+	current.place(r.x, r.y, r.width, r.height)
+
+	lineCount := current.LineCount()
+
+	visual := active && a.visualMode
+	if current.wordWrap || current.jsonPretty {
+		a.drawWrapped(current, lineCount, p.search, visual)
+	} else {
+		a.drawNormal(current, lineCount, p.search, visual)
+	}
+
+	if visual {
+		// Visual mode status bar
+		startLine := a.visualStart
+		endLine := a.visualCursor
+		if startLine > endLine {
+			startLine, endLine = endLine, startLine
+		}
+		status := fmt.Sprintf(" VISUAL: Line %d/%d | Marked %d-%d ",
+			a.visualCursor+1, current.LineCount(), startLine+1, endLine+1)
+		a.drawVisualStatusBar(current, status)
+	} else if active && a.statusMessage != "" && time.Now().Before(a.messageExpiry) {
+		current.showMessage(a.statusMessage)
+	} else {
+		if active {
+			a.statusMessage = ""
+		}
+		// Calculate original line number by tracing through the filters
+		origLine := current.rootLine(current.topLine)
+		origTotal := p.stack.viewers[0].LineCount()
+		
+		// Add search info if there are results
+		searchInfo := ""
+		if p.search.HasResults() {
+			searchInfo = fmt.Sprintf(" | Search: %d/%d", p.search.current+1, len(p.search.matches))
+		}
+		// Show which branch this is when the view below has several
+		if n := len(p.stack.viewers); n > 1 {
+			if parent := p.stack.viewers[n-2]; len(parent.branches) > 1 {
+				searchInfo += fmt.Sprintf(" | Branch %d/%d", parent.visited+1, len(parent.branches))
+			}
+		}
+		a.drawStatusBarWithSearch(current, len(p.stack.viewers), origLine, origTotal, searchInfo, active)
+	}
+}
+
+// paneRect is the part of the screen a pane is drawn in
+type paneRect struct {
+	x, y, width, height int
+}
+
+// paneRects divides the screen between the panes, side by side with a column between
+// them or stacked
+func (a *App) paneRects() []paneRect {
+	width, height := termbox.Size()
+	n := len(a.panes)
+	rects := make([]paneRect, n)
+	for i := range rects {
+		if a.sideBySide {
+			w := (width - (n - 1)) / n
+			rects[i] = paneRect{x: i * (w + 1), width: w, height: height}
+		} else {
+			h := height / n
+			rects[i] = paneRect{y: i * h, width: width, height: h}
+		}
+	}
+	// The last pane gets what's left
+	last := &rects[n-1]
+	if a.sideBySide {
+		last.width = width - last.x
+	} else {
+		last.height = height - last.y
+	}
+	return rects
+}
+
+// dimStatusBar grays out the status bar of a view, to tell inactive panes apart
+func dimStatusBar(v *Viewer) {
+	width, _ := termbox.Size()
+	cells := termbox.CellBuffer()
+	row := (v.originY + v.height) * width
+	for x := v.originX; x < v.originX+v.width && row+x < len(cells); x++ {
+		cells[row+x].Fg = termbox.ColorWhite
+		cells[row+x].Bg = termbox.Attribute(240 + 1)
+	}
+}
+
+// HandlePaneCommand reads the key after Ctrl+W and splits, switches or closes panes
+func (a *App) HandlePaneCommand() {
+	a.ShowTempMessage("Ctrl+W: s/v split  w/W next/previous  c close  o only  t sync by time")
+	a.Draw()
+	ev := termbox.PollEvent()
+	a.ClearMessage()
+	if ev.Type != termbox.EventKey {
 		return
 	}
-	a.timestampFormat = input
-	a.ShowTempMessage(fmt.Sprintf("Format set: %s", input))
+	switch {
+	case ev.Ch == 's' || ev.Ch == 'v':
+		a.splitPane(ev.Ch == 'v')
+	case ev.Ch == 'w' || ev.Key == termbox.KeyCtrlW:
+		a.focusPane((a.active + 1) % len(a.panes))
+	case ev.Ch == 'W':
+		a.focusPane((a.active + len(a.panes) - 1) % len(a.panes))
+	case ev.Ch == 'c' || ev.Ch == 'q':
+		a.closePanes(func(i int) bool { return i == a.active })
+	case ev.Ch == 'o':
+		a.closePanes(func(i int) bool { return i != a.active })
+	case ev.Ch == 't':
+		a.syncTime = !a.syncTime
+		if a.syncTime {
+			a.syncPanes()
+			a.ShowTempMessage("Panes scroll together by time")
+		} else {
+			a.ShowTempMessage("Panes scroll on their own")
+		}
+	}
 }
 
-// HandleTimestampSearch searches for a timestamp
-func (a *App) HandleTimestampSearch() {
+// splitPane adds a pane after the active one showing a file, or the file of the
+// active pane from its current line, and moves to it
+func (a *App) splitPane(sideBySide bool) {
 	current := a.stack.Current()
-	
-	// Get input: 6 digits (hhmmss) or 12 digits (yymmddhhmmss)
-	input, ok := current.promptForInput("b (timestamp [yymmdd]hhmmss): ")
-	if !ok || input == "" {
+	filename, ok := current.promptForInput("Open in new pane (empty for this file): ")
+	if !ok {
+		return
+	}
+
+	var v *Viewer
+	if filename = strings.TrimSpace(filename); filename == "" {
+		v = newMirrorView(current.root(), current.rootLine(current.topLine))
+	} else {
+		var err error
+		if v, err = NewViewer(filename, a.opts); err != nil {
+			a.ShowTempMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+	}
+
+	p := &pane{stack: NewViewerStack(v), search: &SearchState{}}
+	a.panes = append(a.panes[:a.active+1], append([]*pane{p}, a.panes[a.active+1:]...)...)
+	a.sideBySide = sideBySide
+	a.focusPane(a.active + 1)
+}
+
+// newMirrorView creates a view with every line of v, so a pane can show v with its own
+// position, display modes and filters. It opens at line topLine of v.
+func newMirrorView(v *Viewer, topLine int) *Viewer {
+	mirror := &Viewer{
+		parent:   v,
+		loading:  true,
+		filename: v.filename,
+		match:    func(string, bool) bool { return true },
+	}
+	v.subscribe(mirror)
+	go mirror.filterLines(v.Snapshot(), topLine)
+	return mirror
+}
+
+// focusPane makes pane i the active one
+func (a *App) focusPane(i int) {
+	if a.visualMode {
+		a.ExitVisualMode()
+	}
+	a.active = i
+	a.stack = a.panes[i].stack
+	a.search = a.panes[i].search
+}
+
+// closePanes closes the panes close returns true for, keeping at least one
+func (a *App) closePanes(close func(i int) bool) {
+	var kept []*pane
+	active := a.panes[a.active]
+	for i, p := range a.panes {
+		if !close(i) {
+			kept = append(kept, p)
+			continue
+		}
+		// Views filtered from the pane's base view stop getting updates
+		p.stack.viewers[0].unsubscribeTree()
+	}
+	if len(kept) == 0 {
+		return
+	}
+	a.panes = kept
+	next := max(min(a.active, len(kept)-1), 0)
+	for i, p := range kept {
+		if p == active {
+			next = i
+		}
+	}
+	a.focusPane(next)
+}
+
+// syncPanes scrolls the other panes to the time of the top line of the active pane
+func (a *App) syncPanes() {
+	if len(a.panes) < 2 {
+		return
+	}
+	current := a.stack.Current()
+	src := current.Snapshot()
+	format := a.paneFormat(a.panes[a.active])
+	target, at := timeAtLine(src, current.topLine, format)
+	if format == "" || at < 0 {
+		return
+	}
+	for i, p := range a.panes {
+		if i == a.active {
+			continue
+		}
+		v := p.stack.Current()
+		if format := a.paneFormat(p); format != "" {
+			v.topLine = lineAtTime(v.Snapshot(), target, format)
+			v.topLineOffset = 0
+		}
+	}
+}
+
+// paneFormat returns the timestamp format of the file a pane shows, detecting it from
+// the first lines once
+func (a *App) paneFormat(p *pane) string {
+	if a.timestampFormat != "" {
+		return a.timestampFormat
+	}
+	if p.format == "" {
+		src := p.stack.viewers[0].root().Snapshot()
+		for i := 0; p.format == "" && i < src.Len() && i < 1000; i++ {
+			p.format = detectTimestampFormat(src.Line(i))
+		}
+	}
+	return p.format
+}
+
+// timeAtLine returns the timestamp of line i of src, or of the first line after it
+// with one (lines of a stack trace have none), and the line it's on (-1 if none)
+func timeAtLine(src lineSource, i int, format string) (time.Time, int) {
+	for end := min(i+100, src.Len()); i < end; i++ {
+		line := src.Line(i)
+		if src.HasANSI(i) {
+			line = stripANSI(line)
+		}
+		if ts, ok := extractTimestamp(line, format); ok {
+			return ts, i
+		}
+	}
+	return time.Time{}, -1
+}
+
+// lineAtTime returns the first line of src at or after target, by binary search since
+// logs are in time order
+func lineAtTime(src lineSource, target time.Time, format string) int {
+	idx := sort.Search(src.Len(), func(i int) bool {
+		ts, at := timeAtLine(src, i, format)
+		return at < 0 || !ts.Before(target)
+	})
+	// Lines before the one with the timestamp continue an earlier entry
+	if _, at := timeAtLine(src, idx, format); at >= 0 {
+		idx = at
+	}
+	return max(min(idx, src.Len()-1), 0)
+}
+
+// readMarkLetter shows msg and reads the letter of a mark after m or '
+func (a *App) readMarkLetter(msg string) (rune, bool) {
+	a.ShowTempMessage(msg)
+	a.Draw()
+	ev := termbox.PollEvent()
+	a.ClearMessage()
+	if ev.Type != termbox.EventKey || ev.Ch < 'a' || ev.Ch > 'z' {
+		return 0, false
+	}
+	return ev.Ch, true
+}
+
+// HandleSetMark marks the top line of the current view with a letter
+func (a *App) HandleSetMark() {
+	letter, ok := a.readMarkLetter("m (mark a-z)")
+	current := a.stack.Current()
+	if !ok || current.LineCount() == 0 {
+		return
+	}
+	root := current.root()
+	if root.marks == nil {
+		root.marks = make(map[rune]int)
+	}
+	root.marks[letter] = current.rootLine(current.topLine)
+	a.ShowTempMessage(fmt.Sprintf("Mark %c set", letter))
+}
+
+// HandleJumpToMark reads a mark letter and moves to its line
+func (a *App) HandleJumpToMark() {
+	if letter, ok := a.readMarkLetter("' (jump to mark a-z)"); ok {
+		a.jumpToMark(letter)
+	}
+}
+
+// jumpToMark moves to the line of a mark, or the next line of the current view if
+// a filter hides it
+func (a *App) jumpToMark(letter rune) {
+	current := a.stack.Current()
+	line, ok := current.root().marks[letter]
+	if !ok {
+		a.ShowTempMessage(fmt.Sprintf("Mark %c not set", letter))
+		return
+	}
+	current.topLine = current.lineForRoot(line)
+	current.topLineOffset = 0
+	if current.rootLine(current.topLine) != line {
+		a.ShowTempMessage(fmt.Sprintf("Line of mark %c is filtered out, showing the next one", letter))
+	}
+}
+
+// HandleMarks shows the marks of the file in a panel to jump to or delete
+func (a *App) HandleMarks() {
+	current := a.stack.Current()
+	root := current.root()
+	selected := 0
+	for {
+		letters := make([]rune, 0, len(root.marks))
+		for letter := range root.marks {
+			letters = append(letters, letter)
+		}
+		sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+
+		// Lines shown by the current view, to tell which marks its filters hide
+		_, shown := rootIndices(current.Snapshot())
+		src := root.Snapshot()
+		rows := make([]panelRow, len(letters))
+		for i, letter := range letters {
+			line := root.marks[letter]
+			text := src.Line(line)
+			if src.HasANSI(line) {
+				text = stripANSI(text)
+			}
+			info := fmt.Sprintf("line %d", line+1)
+			if idx := sort.SearchInts(shown, line); idx == len(shown) || shown[idx] != line {
+				info += " [filtered out]"
+			}
+			rows[i] = panelRow{text: fmt.Sprintf("%c  %s", letter, text), info: info}
+		}
+		a.drawPanel(fmt.Sprintf("Marks (%d)", len(letters)), rows, selected, "Enter:jump  d:delete  q:close")
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'M':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, max(len(rows)-1, 0))
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case len(letters) == 0:
+			// Nothing to act on
+		case ev.Key == termbox.KeyEnter:
+			a.jumpToMark(letters[selected])
+			return
+		case ev.Ch == 'd' || ev.Ch == 'x':
+			delete(root.marks, letters[selected])
+			selected = max(min(selected, len(letters)-2), 0)
+		}
+	}
+}
+
+// savedNote is a note as kept in the notes file: the file and line it's on, and a hash
+// of the line's text to find the line again if it moved
+type savedNote struct {
+	path string
+	line int
+	hash uint64
+	text string
+}
+
+// placedNote is a kept note and the line found for it
+type placedNote struct {
+	line int
+	note savedNote
+}
+
+// notesSidecarSuffix names the notes file next to a log (app.log.sieve-notes)
+const notesSidecarSuffix = ".sieve-notes"
+
+// notesPaths returns the files the notes of the file at path (a notesKey) are kept in:
+// the sidecar next to it, and the notes file in the config directory used instead for
+// files in directories that can't be written. Notes in the sidecar are keyed by the
+// file's base name, so the two can be moved together.
+func notesPaths(path string) (sidecar, fallback string) {
+	return path + notesSidecarSuffix, configPath("notes")
+}
+
+// lineHash returns the hash of a line's text notes find their line by
+func lineHash(line string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	return h.Sum64()
+}
+
+// readNotes reads the notes file, one tab separated note per line: path, line number,
+// line hash and note. Lines starting with # and lines that don't parse are skipped.
+func readNotes(filename string) []savedNote {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var notes []savedNote
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		hash, err := strconv.ParseUint(fields[2], 16, 64)
+		if err != nil {
+			continue
+		}
+		notes = append(notes, savedNote{path: fields[0], line: n - 1, hash: hash, text: fields[3]})
+	}
+	return notes
+}
+
+// writeNotes writes notes in the format readNotes reads
+func writeNotes(filename string, notes []savedNote) error {
+	var sb strings.Builder
+	sb.WriteString("# path\tline\thash\tnote\n")
+	for _, n := range notes {
+		fmt.Fprintf(&sb, "%s\t%d\t%016x\t%s\n", n.path, n.line+1, n.hash, n.text)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
+
+// notesKey returns the path the notes of v's lines are saved under, "" for piped and
+// merged input, whose notes aren't saved
+func (v *Viewer) notesKey() string {
+	if v.stream || v.multiFile || v.filename == "" {
+		return ""
+	}
+	path, err := filepath.Abs(v.filename)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// readSavedNotes returns the saved notes of the file at path (a notesKey): those in
+// its sidecar if it has one, else those in the fallback notes file
+func readSavedNotes(path string) []savedNote {
+	sidecar, fallback := notesPaths(path)
+	file, key := fallback, path
+	if _, err := os.Stat(sidecar); err == nil {
+		file, key = sidecar, filepath.Base(path)
+	}
+	var notes []savedNote
+	for _, n := range readNotes(file) {
+		if n.path == key {
+			notes = append(notes, n)
+		}
+	}
+	return notes
+}
+
+// attachNotes puts the saved notes of the root viewer v's file on its lines once it
+// has loaded. A note whose line no longer has the same text is kept while the first
+// line that does (lines were added above it) is looked for in the background; Draw
+// calls attachNotes again, which moves the note there if the line has none by then.
+func (v *Viewer) attachNotes() {
+	v.mu.Lock()
+	placed := v.notesPlaced
+	v.notesPlaced = nil
+	v.mu.Unlock()
+	if len(placed) > 0 {
+		for _, p := range placed {
+			if _, ok := v.notes[p.line]; ok {
+				continue
+			}
+			for i, n := range v.notesKept {
+				if n == p.note {
+					v.setNote(p.line, n.text)
+					v.notesKept = append(v.notesKept[:i:i], v.notesKept[i+1:]...)
+					break
+				}
+			}
+		}
+		// Saved at their new lines, so they're found right away next time
+		v.saveNotes()
+	}
+
+	if v.notesLoaded || v.IsLoading() {
 		return
 	}
-	
-	// Validate input
-	if len(input) != 6 && len(input) != 12 {
-		a.ShowTempMessage("Enter 6 (hhmmss) or 12 (yymmddhhmmss) digits")
+	v.notesLoaded = true
+	key := v.notesKey()
+	if key == "" {
 		return
 	}
-	for _, c := range input {
-		if c < '0' || c > '9' {
-			a.ShowTempMessage("Enter digits only")
+
+	src := v.Snapshot()
+	moved := make(map[uint64][]savedNote)
+	for _, n := range readSavedNotes(key) {
+		if n.line >= 0 && n.line < src.Len() && lineHash(src.Line(n.line)) == n.hash {
+			v.setNote(n.line, n.text)
+		} else {
+			v.notesKept = append(v.notesKept, n)
+			moved[n.hash] = append(moved[n.hash], n)
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+	taken := make(map[int]bool, len(v.notes))
+	for i := range v.notes {
+		taken[i] = true
+	}
+	// Hashing every line of a big file takes a while
+	v.placing.Add(1)
+	go func() {
+		defer v.placing.Done()
+		var placed []placedNote
+		for i := 0; i < src.Len() && len(moved) > 0; i++ {
+			hash := lineHash(src.Line(i))
+			if taken[i] || len(moved[hash]) == 0 {
+				continue
+			}
+			placed = append(placed, placedNote{line: i, note: moved[hash][0]})
+			if moved[hash] = moved[hash][1:]; len(moved[hash]) == 0 {
+				delete(moved, hash)
+			}
+		}
+		if len(placed) == 0 {
 			return
 		}
+		v.mu.Lock()
+		v.notesPlaced = placed
+		v.mu.Unlock()
+		termbox.Interrupt()
+	}()
+}
+
+// setNote sets the note of line i of the root viewer v, or deletes it if text is empty
+func (v *Viewer) setNote(i int, text string) {
+	if text == "" {
+		delete(v.notes, i)
+		return
 	}
-	
-	// Parse target time
-	var targetTime time.Time
-	now := time.Now()
-	if len(input) == 6 {
-		// hhmmss - use today's date
-		h, _ := strconv.Atoi(input[0:2])
-		m, _ := strconv.Atoi(input[2:4])
-		s, _ := strconv.Atoi(input[4:6])
-		targetTime = time.Date(now.Year(), now.Month(), now.Day(), h, m, s, 0, time.Local)
+	if v.notes == nil {
+		v.notes = make(map[int]string)
+	}
+	v.notes[i] = text
+}
+
+// saveNotes writes the notes of the root viewer v to the sidecar next to its file, or
+// if that can't be written to the fallback notes file in place of the ones saved for
+// the file before. A sidecar left without notes is removed.
+func (v *Viewer) saveNotes() error {
+	key := v.notesKey()
+	if key == "" {
+		return nil
+	}
+	lines := make([]int, 0, len(v.notes))
+	for i := range v.notes {
+		lines = append(lines, i)
+	}
+	sort.Ints(lines)
+	src := v.Snapshot()
+	notes := make([]savedNote, 0, len(lines)+len(v.notesKept))
+	for _, i := range lines {
+		notes = append(notes, savedNote{line: i, hash: lineHash(src.Line(i)), text: v.notes[i]})
+	}
+	notes = append(notes, v.notesKept...)
+
+	sidecar, fallback := notesPaths(key)
+	var err error
+	if len(notes) == 0 {
+		if err = os.Remove(sidecar); os.IsNotExist(err) {
+			err = nil
+		}
 	} else {
-		// yymmddhhmmss
-		y, _ := strconv.Atoi(input[0:2])
-		mo, _ := strconv.Atoi(input[2:4])
-		d, _ := strconv.Atoi(input[4:6])
-		h, _ := strconv.Atoi(input[6:8])
-		mi, _ := strconv.Atoi(input[8:10])
-		s, _ := strconv.Atoi(input[10:12])
-		year := 2000 + y
-		if y > 50 {
-			year = 1900 + y
+		for i := range notes {
+			notes[i].path = filepath.Base(key)
+		}
+		err = writeNotes(sidecar, notes)
+	}
+	// The fallback keeps the notes of the file only if the sidecar can't
+	var others []savedNote
+	found := false
+	for _, n := range readNotes(fallback) {
+		if n.path == key {
+			found = true
+		} else {
+			others = append(others, n)
 		}
-		targetTime = time.Date(year, time.Month(mo), d, h, mi, s, 0, time.Local)
 	}
-	
-	// Detect or use set format
-	format := a.timestampFormat
-	if format == "" {
-		// Try to detect from current line
-		line := current.GetLine(current.topLine)
-		format = detectTimestampFormat(line)
-		if format == "" {
-			a.ShowTempMessage("Couldn't detect timestamp format. Use 't' to set.")
-			return
+	if err == nil {
+		if found {
+			return writeNotes(fallback, others)
 		}
+		return nil
 	}
-	
-	// Search from current line to end
-	lines := current.GetLines()
-	for i := current.topLine; i < len(lines); i++ {
-		ts, ok := extractTimestamp(lines[i], format)
-		if ok {
-			// For time-only searches, adjust the date to match
-			if len(input) == 6 {
-				ts = time.Date(now.Year(), now.Month(), now.Day(), ts.Hour(), ts.Minute(), ts.Second(), 0, time.Local)
+	for i := range notes {
+		notes[i].path = key
+	}
+	return writeNotes(fallback, append(others, notes...))
+}
+
+// HandleNote prompts for the note of the top line of the current view, showing the
+// note it has to edit. An empty note deletes it.
+func (a *App) HandleNote() {
+	current := a.stack.Current()
+	if current.LineCount() == 0 {
+		return
+	}
+	a.editNote(current.root(), current.rootLine(current.topLine))
+}
+
+// editNote prompts for the note of line of root and saves it
+func (a *App) editNote(root *Viewer, line int) {
+	text, ok := a.stack.Current().editInput(fmt.Sprintf("a (note on line %d, empty deletes): ", line+1), root.notes[line])
+	if !ok {
+		return
+	}
+	// The notes file has one note per line, tab separated
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\t", " "))
+	root.setNote(line, text)
+	switch err := root.saveNotes(); {
+	case err != nil:
+		a.ShowTempMessage("Couldn't save notes: " + err.Error())
+	case root.notesKey() == "":
+		a.ShowTempMessage("Notes on piped or merged input aren't saved")
+	}
+}
+
+// HandleNotes shows the notes on lines of the file in a panel to jump to, edit or
+// delete
+func (a *App) HandleNotes() {
+	current := a.stack.Current()
+	root := current.root()
+	selected := 0
+	for {
+		lines := make([]int, 0, len(root.notes))
+		for i := range root.notes {
+			lines = append(lines, i)
+		}
+		sort.Ints(lines)
+
+		rows := make([]panelRow, len(lines))
+		for i, line := range lines {
+			rows[i] = panelRow{text: root.notes[line], info: fmt.Sprintf("line %d", line+1)}
+		}
+		footer := "Enter:jump  e:edit  d:delete  q:close"
+		if len(root.notesKept) > 0 {
+			footer += fmt.Sprintf("  (%d saved notes whose lines are gone)", len(root.notesKept))
+		}
+		a.drawPanel(fmt.Sprintf("Notes (%d)", len(lines)), rows, selected, footer)
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'A':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, max(len(rows)-1, 0))
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeyCtrlD:
+			selected = min(selected+10, max(len(rows)-1, 0))
+		case ev.Key == termbox.KeyPgup || ev.Key == termbox.KeyCtrlU:
+			selected = max(selected-10, 0)
+		case len(lines) == 0:
+			// Nothing to act on
+		case ev.Key == termbox.KeyEnter:
+			current.topLine = current.lineForRoot(lines[selected])
+			current.topLineOffset = 0
+			if current.rootLine(current.topLine) != lines[selected] {
+				a.ShowTempMessage("The noted line is filtered out, showing the next one")
 			}
-			if ts.Equal(targetTime) || ts.After(targetTime) {
-				current.topLine = i
-				a.ShowTempMessage(fmt.Sprintf("Found at line %d", i+1))
-				return
+			return
+		case ev.Ch == 'e':
+			a.Draw()
+			a.editNote(root, lines[selected])
+		case ev.Ch == 'd' || ev.Ch == 'x':
+			root.setNote(lines[selected], "")
+			if err := root.saveNotes(); err != nil {
+				a.ShowTempMessage("Couldn't save notes: " + err.Error())
 			}
+			selected = max(min(selected, len(lines)-2), 0)
 		}
 	}
-	a.ShowTempMessage("No matching timestamp found")
 }
 
-// ShowHelp displays the help screen
-func (a *App) ShowHelp() {
-	type helpEntry struct {
-		key  string
-		desc string
-	}
+// tab is a file opened on its own, with its own panes
+type tab struct {
+	panes      []*pane
+	active     int
+	sideBySide bool
+	syncTime   bool
+}
 
-	sections := []struct {
-		title   string
-		entries []helpEntry
-	}{
-		{"Navigation", []helpEntry{
-			{"j / ↓", "Move down one line"},
-			{"k / ↑", "Move up one line"},
-			{"h / ←", "Scroll left"},
-			{"l / →", "Scroll right"},
-			{"< / >", "Scroll left/right by 1 char"},
-			{"g / Home", "Go to first line"},
-			{"G / End", "Go to last line"},
-			{"Ctrl+D/Space/PgDn", "Page down"},
-			{"Ctrl+U/PgUp", "Page up"},
-			{":<number>", "Go to specific line number"},
-		}},
-		{"Search", []helpEntry{
-			{"/", "Search forward"},
-			{"?", "Search backward"},
-			{"n", "Next match"},
-			{"N", "Previous match"},
-			{"Ctrl+R", "Toggle regex mode (in prompt)"},
-			{"Ctrl+I", "Toggle case-insensitive (in prompt)"},
-		}},
-		{"Timestamp", []helpEntry{
-			{"t", "Set timestamp format (Python style)"},
-			{"b", "Jump to timestamp ([yymmdd]hhmmss)"},
-		}},
-		{"Filters", []helpEntry{
-			{"&", "Keep lines matching pattern"},
-			{"-", "Exclude lines matching pattern"},
-			{"+", "Add matching from original file"},
-			{"=", "Reset to original file"},
-			{"U", "Pop last filter (go back one level)"},
-		}},
-		{"Display", []helpEntry{
-			{"w", "Toggle word wrap"},
-			{"f", "Toggle JSON pretty-print"},
-			{"F", "Toggle follow mode (tail -f)"},
-			{"K", "Set sticky left columns"},
-			{"L", "Toggle line numbers"},
-		}},
-		{"Selection & Export", []helpEntry{
-			{"v", "Enter visual selection mode"},
-			{"y", "Yank (copy) selected lines"},
-			{";", "Export filtered view to file"},
-			{"Esc", "Exit visual mode"},
-		}},
-		{"Help", []helpEntry{
-			{"H / F1", "Show this help screen"},
-			{"q", "Quit"},
-		}},
-	}
+// saveTab stores the panes of the current tab in it
+func (a *App) saveTab() {
+	a.tabs[a.currentTab] = &tab{panes: a.panes, active: a.active, sideBySide: a.sideBySide, syncTime: a.syncTime}
+}
 
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-	width, height := termbox.Size()
+// focusTab makes tab i the current one
+func (a *App) focusTab(i int) {
+	a.saveTab()
+	t := a.tabs[i]
+	a.currentTab = i
+	a.panes, a.sideBySide, a.syncTime = t.panes, t.sideBySide, t.syncTime
+	a.focusPane(t.active)
+}
 
-	// Use nearly full screen with some margin
-	margin := 2
-	boxWidth := width - margin*2
-	boxHeight := height - margin*2
-	if boxWidth < 40 {
-		boxWidth = 40
+// addTab opens a tab showing v after the current one and moves to it
+func (a *App) addTab(v *Viewer) {
+	t := &tab{panes: []*pane{{stack: NewViewerStack(v), search: &SearchState{}}}}
+	a.saveTab()
+	a.tabs = append(a.tabs[:a.currentTab+1], append([]*tab{t}, a.tabs[a.currentTab+1:]...)...)
+	a.focusTab(a.currentTab + 1)
+}
+
+// HandleOpenTab prompts for a file and opens it in a new tab
+func (a *App) HandleOpenTab() {
+	filename, ok := a.stack.Current().promptForInput("Open in new tab: ")
+	if filename = strings.TrimSpace(filename); !ok || filename == "" {
+		return
 	}
-	if boxHeight < 20 {
-		boxHeight = 20
+	v, err := NewViewer(filename, a.opts)
+	if err != nil {
+		a.ShowTempMessage(fmt.Sprintf("Error: %v", err))
+		return
 	}
-	if boxWidth > width {
-		boxWidth = width
+	a.addTab(v)
+}
+
+// HandleCloseTab closes the current tab and moves to the one before it
+func (a *App) HandleCloseTab() {
+	if len(a.tabs) == 1 {
+		a.ShowTempMessage("Can't close the last tab (q quits)")
+		return
 	}
-	if boxHeight > height {
-		boxHeight = height
+	// Panes of a tab only show its file (or each other's, mirrored)
+	var views, roots []*Viewer
+	for _, p := range a.panes {
+		base := p.stack.viewers[0]
+		base.unsubscribeTree()
+		views = base.appendTree(views)
+		if root := base.root(); !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
 	}
-	startX := (width - boxWidth) / 2
-	startY := (height - boxHeight) / 2
+	for _, root := range roots {
+		root.close(views)
+	}
+	i := a.currentTab
+	a.tabs = append(a.tabs[:i], a.tabs[i+1:]...)
+	// The closed tab isn't saved over its neighbor
+	t := a.tabs[max(i-1, 0)]
+	a.currentTab = max(i-1, 0)
+	a.panes, a.sideBySide, a.syncTime = t.panes, t.sideBySide, t.syncTime
+	a.focusPane(t.active)
+}
 
-	// Colors
-	borderFg := termbox.ColorCyan
-	titleFg := termbox.ColorYellow | termbox.AttrBold
-	sectionFg := termbox.ColorGreen | termbox.AttrBold
-	keyFg := termbox.ColorWhite | termbox.AttrBold
-	descFg := termbox.ColorDefault
-	bgColor := termbox.ColorDefault
+// HandleNextTab moves to the next tab (or the previous one if step is -1)
+func (a *App) HandleNextTab(step int) {
+	if len(a.tabs) == 1 {
+		a.ShowTempMessage("Only one tab (o opens a file in a new one)")
+		return
+	}
+	a.focusTab((a.currentTab + step + len(a.tabs)) % len(a.tabs))
+}
 
-	// Draw border
-	drawBox := func(x, y, w, h int) {
-		// Corners
-		termbox.SetCell(x, y, '╭', borderFg, bgColor)
-		termbox.SetCell(x+w-1, y, '╮', borderFg, bgColor)
-		termbox.SetCell(x, y+h-1, '╰', borderFg, bgColor)
-		termbox.SetCell(x+w-1, y+h-1, '╯', borderFg, bgColor)
-		// Top and bottom
-		for i := 1; i < w-1; i++ {
-			termbox.SetCell(x+i, y, '─', borderFg, bgColor)
-			termbox.SetCell(x+i, y+h-1, '─', borderFg, bgColor)
+// tabName returns the name of tab i shown in the tab bar
+func (a *App) tabName(i int) string {
+	panes, active := a.tabs[i].panes, a.tabs[i].active
+	if i == a.currentTab {
+		panes, active = a.panes, a.active
+	}
+	root := panes[active].stack.viewers[0].root()
+	if root.multiFile {
+		return "merged"
+	}
+	return filepath.Base(root.filename)
+}
+
+// drawTabBar draws the tabs right-aligned in the status bar of v, the current one
+// highlighted, after status. If they don't all fit only the current one is shown.
+func (a *App) drawTabBar(v *Viewer, status string) {
+	names := make([]string, len(a.tabs))
+	width := 1
+	for i := range a.tabs {
+		names[i] = fmt.Sprintf(" %d:%s ", i+1, a.tabName(i))
+		width += len([]rune(names[i]))
+	}
+	if v.width-width <= len([]rune(status)) {
+		names = []string{fmt.Sprintf(" %d/%d:%s ", a.currentTab+1, len(a.tabs), a.tabName(a.currentTab))}
+		width = len([]rune(names[0])) + 1
+	}
+
+	x := v.width - width
+	for i, name := range names {
+		fg, bg := termbox.ColorBlack, termbox.ColorWhite
+		if i == a.currentTab || len(names) == 1 {
+			fg, bg = termbox.ColorBlack|termbox.AttrBold, termbox.ColorCyan
 		}
-		// Left and right
-		for i := 1; i < h-1; i++ {
-			termbox.SetCell(x, y+i, '│', borderFg, bgColor)
-			termbox.SetCell(x+w-1, y+i, '│', borderFg, bgColor)
+		for _, ch := range name {
+			if x > len([]rune(status)) {
+				v.setCell(x, v.height, ch, fg, bg)
+			}
+			x++
 		}
-		// Fill inside with background
-		for row := 1; row < h-1; row++ {
-			for col := 1; col < w-1; col++ {
-				termbox.SetCell(x+col, y+row, ' ', descFg, bgColor)
+	}
+}
+
+// drawNormal renders without word wrap
+// getLineNumWidth returns the width of the gutter: line numbers, after columns for
+// marks and notes when the file has any
+func (v *Viewer) getLineNumWidth() int {
+	width := 0
+	if root := v.root(); len(root.marks) > 0 || len(root.notes) > 0 {
+		width = 3
+	}
+	if !v.showLineNumbers {
+		return width
+	}
+	// Calculate digits needed for max line number
+	maxLine := v.LineCount()
+	digits := 1
+	for maxLine >= 10 {
+		maxLine /= 10
+		digits++
+	}
+	return width + digits + 1 // +1 for separator space
+}
+
+// lineMarks returns the letters of the marks of the file by root line (the first
+// letter if a line has several), nil if there are none
+func (v *Viewer) lineMarks() map[int]rune {
+	marks := v.root().marks
+	if len(marks) == 0 {
+		return nil
+	}
+	lines := make(map[int]rune, len(marks))
+	for letter, line := range marks {
+		if l, ok := lines[line]; !ok || letter < l {
+			lines[line] = letter
+		}
+	}
+	return lines
+}
+
+// drawGutter draws the gutter of a screen row, the mark, note indicator and number of
+// line lineIndex on its first row and blanks on the rows it continues onto, and
+// returns its width
+func (v *Viewer) drawGutter(screenY, lineIndex int, firstRow bool, marks map[int]rune) int {
+	screenX := 0
+	if notes := v.root().notes; marks != nil || len(notes) > 0 {
+		mark, note := ' ', ' '
+		if firstRow {
+			line := v.rootLine(lineIndex)
+			if letter, ok := marks[line]; ok {
+				mark = letter
+			}
+			if _, ok := notes[line]; ok {
+				note = '*'
 			}
 		}
+		v.setCell(0, screenY, mark, termbox.ColorYellow|termbox.AttrBold, termbox.ColorDefault)
+		v.setCell(1, screenY, note, termbox.ColorCyan|termbox.AttrBold, termbox.ColorDefault)
+		v.setCell(2, screenY, ' ', termbox.ColorDefault, termbox.ColorDefault)
+		screenX = 3
 	}
-
-	drawText := func(x, y int, text string, fg termbox.Attribute) {
-		for i, ch := range text {
-			if x+i < startX+boxWidth-1 {
-				termbox.SetCell(x+i, y, ch, fg, bgColor)
-			}
+	if !v.showLineNumbers {
+		return screenX
+	}
+	lineNumFg := termbox.Attribute(244) // Gray color for line numbers
+	lineNumStr := fmt.Sprintf("%*d ", v.getLineNumWidth()-screenX-1, lineIndex+1)
+	for _, ch := range lineNumStr {
+		if !firstRow {
+			// Fill with spaces for continuation rows
+			v.setCell(screenX, screenY, ' ', termbox.ColorDefault, termbox.ColorDefault)
+		} else {
+			v.setCell(screenX, screenY, ch, lineNumFg, termbox.ColorDefault)
 		}
+		screenX++
 	}
+	return screenX
+}
 
-	drawBox(startX, startY, boxWidth, boxHeight)
+func (a *App) drawNormal(current *Viewer, lineCount int, search *SearchState, visual bool) {
+	screenY := 0
+	lineIndex := current.topLine
+	skipRows := current.topLineOffset // Skip this many rows at start
 
-	// Title
-	title := fmt.Sprintf(" CUT v%s - Keybindings ", version)
-	titleX := startX + (boxWidth-len(title))/2
-	drawText(titleX, startY, title, titleFg)
+	// Pastel blue color (using 256-color mode: color 117 is a light blue)
+	stickyFg := termbox.Attribute(117 + 1) // +1 because termbox uses 1-indexed colors
 
-	// Calculate columns
-	colWidth := (boxWidth - 4) / 3
-	if colWidth < 25 {
-		colWidth = (boxWidth - 4) / 2
+	// Marks of the lines, drawn in the gutter
+	marks := current.lineMarks()
+
+	// Calculate effective sticky columns
+	stickyActive := current.stickyLeft > 0
+	stickyWidth := current.stickyLeft
+	if stickyActive && stickyWidth > current.width/2 {
+		stickyWidth = current.width / 2 // Cap at half screen
 	}
 
-	// Draw sections across columns
-	col := 0
-	y := startY + 2
-	maxY := startY + boxHeight - 3
+	// Visual selection range
+	var visualStart, visualEnd int
+	if visual {
+		visualStart = a.visualStart
+		visualEnd = a.visualCursor
+		if visualStart > visualEnd {
+			visualStart, visualEnd = visualEnd, visualStart
+		}
+	}
 
-	for _, section := range sections {
-		colX := startX + 2 + col*colWidth
+	for screenY < current.height && lineIndex < lineCount {
+		line := current.GetLine(lineIndex)
 
-		// Check if section fits in current column
-		neededRows := 1 + len(section.entries) + 1
-		if y+neededRows > maxY && col < 2 {
-			// Move to next column
-			col++
-			colX = startX + 2 + col*colWidth
-			y = startY + 2
-		}
+		// Check if this line is in visual selection
+		inVisualSelection := visual && lineIndex >= visualStart && lineIndex <= visualEnd
 
-		if y >= maxY {
-			break // No more room
+		// Expand JSON if enabled
+		var linesToRender []string
+		if current.jsonPretty && isJSON(line) {
+			linesToRender = formatJSON(line)
+		} else {
+			linesToRender = []string{line}
 		}
 
-		drawText(colX, y, section.title, sectionFg)
-		y++
+		// Lines with a gap after them in the parent are underlined (context views)
+		separator := current.endsGroup(lineIndex)
+		level := a.levelOf(line)
 
-		for _, entry := range section.entries {
-			if y >= maxY {
+		isFirstRow := true
+		for renderIdx, renderLine := range linesToRender {
+			if skipRows > 0 {
+				skipRows--
+				isFirstRow = false
+				continue
+			}
+			if screenY >= current.height {
 				break
 			}
-			drawText(colX, y, fmt.Sprintf("%-12s", entry.key), keyFg)
-			drawText(colX+13, y, entry.desc, descFg)
-			y++
-		}
-		y++ // Space between sections
-	}
 
-	// Footer
-	footer := "Press any key to close"
-	footerX := startX + (boxWidth-len(footer))/2
-	drawText(footerX, startY+boxHeight-2, footer, termbox.ColorDefault|termbox.AttrDim)
+			cells := parseANSI(renderLine)
+			a.tintLevel(cells, level)
+			a.applyHighlights(cells)
+			matchPositions := getMatchPositions(search, cells)
 
-	termbox.Flush()
+			// Draw line number (only on first row of logical line)
+			screenX := current.drawGutter(screenY, lineIndex, isFirstRow, marks)
+			isFirstRow = false
 
-	// Wait for any key
-	for {
-		ev := termbox.PollEvent()
-		if ev.Type == termbox.EventKey {
-			break
-		}
-	}
-}
+			// Visual selection background color
+			visualBg := termbox.Attribute(239) // Dark gray for selection
 
-// ClearMessage clears the status message
-func (a *App) ClearMessage() {
-	a.statusMessage = ""
-}
+			if stickyActive {
+				// Draw sticky left columns in pastel blue
+				for i := 0; i < stickyWidth && i < len(cells); i++ {
+					if screenX >= current.width {
+						break
+					}
+					fg := stickyFg
+					bg := termbox.ColorDefault
+					if inVisualSelection {
+						bg = visualBg
+					}
+					// Preserve search highlighting even in sticky area
+					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
+						fg = termbox.ColorBlack
+						bg = termbox.ColorYellow
+					}
+					current.setCell(screenX, screenY, cells[i].char, fg, bg)
+					screenX++
+				}
 
-// filterChunkResult holds the result of filtering a chunk
-type filterChunkResult struct {
-	chunkIdx int
-	lines    []string
-	hasANSI  []bool // Whether each line has ANSI codes
-	indices  []int  // Original line indices
-}
 
-// createMatcher creates a matcher function based on search options
-// Returns matcher function and error (if regex is invalid)
-func createMatcher(query string, isRegex, ignoreCase bool) (func(line string, hasANSI bool) bool, error) {
-	if isRegex {
-		pattern := query
-		if ignoreCase {
-			pattern = "(?i)" + pattern
-		}
-		re, err := regexp.Compile(pattern)
-		if err != nil {
-			return nil, err
-		}
-		return func(line string, hasANSI bool) bool {
-			if hasANSI {
-				return re.MatchString(stripANSI(line))
+				// Draw the rest of the line starting from leftCol (or after sticky if not scrolled)
+				startCol := current.leftCol
+				if current.leftCol == 0 {
+					startCol = stickyWidth // Skip sticky chars that were already drawn
+				}
+				for i := startCol; i < len(cells); i++ {
+					if screenX >= current.width {
+						break
+					}
+					fg, bg := cells[i].fg, cells[i].bg
+					if inVisualSelection {
+						bg = visualBg
+					}
+					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
+						fg = termbox.ColorBlack
+						bg = termbox.ColorYellow
+					}
+					current.setCell(screenX, screenY, cells[i].char, fg, bg)
+					screenX++
+				}
+				// Fill rest of line with selection color if in visual mode
+				if inVisualSelection {
+					for screenX < current.width {
+						current.setCell(screenX, screenY, ' ', termbox.ColorDefault, visualBg)
+						screenX++
+					}
+				}
+			} else {
+				// Normal rendering (no sticky)
+				for i, cell := range cells {
+					if i < current.leftCol {
+						continue
+					}
+					if screenX >= current.width {
+						break
+					}
+					fg, bg := cell.fg, cell.bg
+					if inVisualSelection {
+						bg = visualBg
+					}
+					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
+						fg = termbox.ColorBlack
+						bg = termbox.ColorYellow
+					}
+					current.setCell(screenX, screenY, cell.char, fg, bg)
+					screenX++
+				}
+				// Fill rest of line with selection color if in visual mode
+				if inVisualSelection {
+					for screenX < current.width {
+						current.setCell(screenX, screenY, ' ', termbox.ColorDefault, visualBg)
+						screenX++
+					}
+				}
 			}
-			return re.MatchString(line)
-		}, nil
-	} else if ignoreCase {
-		queryLower := strings.ToLower(query)
-		return func(line string, hasANSI bool) bool {
-			if hasANSI {
-				return strings.Contains(strings.ToLower(stripANSI(line)), queryLower)
+			if separator && renderIdx == len(linesToRender)-1 {
+				current.underlineRow(screenY)
 			}
-			return strings.Contains(strings.ToLower(line), queryLower)
-		}, nil
-	}
-	return func(line string, hasANSI bool) bool {
-		if hasANSI {
-			return strings.Contains(stripANSI(line), query)
+			screenY++
 		}
-		return strings.Contains(line, query)
-	}, nil
+		lineIndex++
+	}
 }
 
-// HandleFilter filters lines based on query
-// If keep is true (&), keeps matching lines; if false (-), excludes matching lines
-func (a *App) HandleFilter(keep bool) {
-	current := a.stack.Current()
-	currentTopLine := current.topLine
-
-	prompt := "&"
-	if !keep {
-		prompt = "-"
+// underlineRow underlines a drawn row of the view, separating groups of lines
+func (v *Viewer) underlineRow(y int) {
+	screenWidth, _ := termbox.Size()
+	cells := termbox.CellBuffer()
+	row := (v.originY + y) * screenWidth
+	for x := v.originX; x < v.originX+v.width && row+x < len(cells); x++ {
+		cells[row+x].Fg |= termbox.AttrUnderline
 	}
+}
 
-	query, isRegex, ignoreCase, ok := a.promptWithModifiers(prompt)
-	if ok && query != "" {
-		lines := current.GetLines()       // Get snapshot for thread-safety
-		hasANSICache := current.GetHasANSI() // Get ANSI cache
+// drawWrapped renders with word wrap, highlighting the matches of search and the visual
+// selection if visual
+func (a *App) drawWrapped(current *Viewer, lineCount int, search *SearchState, visual bool) {
+	screenY := 0
+	lineIndex := current.topLine
+	skipRows := current.topLineOffset // Skip this many rows at start
+	rowInLine := 0                    // Current row within the logical line
 
-		matcher, err := createMatcher(query, isRegex, ignoreCase)
-		if err != nil {
-			a.ShowTempMessage("Invalid regex: " + err.Error())
-			return
-		}
+	// Line number width (0 if disabled)
+	lineNumWidth := current.getLineNumWidth()
+	marks := current.lineMarks()
+	wrapWidth := current.width - lineNumWidth
 
-		// Create new viewer immediately with loading state
-		newViewer := &Viewer{
-			lines:    nil,
-			loading:  true,
-			filename: current.filename,
-			topLine:  0,
-			leftCol:  0,
+	// Visual selection range (line and offset)
+	var visualStartLine, visualStartOff, visualEndLine, visualEndOff int
+	if visual {
+		visualStartLine = a.visualStart
+		visualStartOff = a.visualStartOffset
+		visualEndLine = a.visualCursor
+		visualEndOff = a.visualCursorOffset
+		// Ensure start <= end
+		if visualStartLine > visualEndLine || (visualStartLine == visualEndLine && visualStartOff > visualEndOff) {
+			visualStartLine, visualEndLine = visualEndLine, visualStartLine
+			visualStartOff, visualEndOff = visualEndOff, visualStartOff
 		}
-		a.stack.Push(newViewer)
-		a.search.Clear()
+	}
 
-		// Filter in parallel
-		go func() {
-			numWorkers := 8
-			totalLines := len(lines)
-			if totalLines < numWorkers {
-				numWorkers = 1
-			}
-			chunkSize := (totalLines + numWorkers - 1) / numWorkers
+	for screenY < current.height && lineIndex < lineCount {
+		line := current.GetLine(lineIndex)
 
-			resultChan := make(chan filterChunkResult, numWorkers)
+		// Expand JSON if enabled
+		var linesToRender []string
+		if current.jsonPretty && isJSON(line) {
+			linesToRender = formatJSON(line)
+		} else {
+			linesToRender = []string{line}
+		}
 
-			// Start workers
-			for w := 0; w < numWorkers; w++ {
-				start := w * chunkSize
-				end := start + chunkSize
-				if end > totalLines {
-					end = totalLines
-				}
-				if start >= totalLines {
-					break
-				}
+		// Lines with a gap after them in the parent are underlined (context views)
+		separator := current.endsGroup(lineIndex)
+		level := a.levelOf(line)
 
-				go func(chunkIdx, start, end int) {
-					var chunkLines []string
-					var chunkHasANSI []bool
-					var chunkIndices []int
-					for i := start; i < end; i++ {
-						has := i < len(hasANSICache) && hasANSICache[i]
-						matches := matcher(lines[i], has)
-						if matches == keep {
-							chunkLines = append(chunkLines, lines[i])
-							chunkHasANSI = append(chunkHasANSI, has)
-							chunkIndices = append(chunkIndices, i)
+		rowInLine = 0
+		isFirstRowOfLine := true
+		for renderIdx, renderLine := range linesToRender {
+			lastRender := renderIdx == len(linesToRender)-1
+			cells := parseANSI(renderLine)
+			a.tintLevel(cells, level)
+			a.applyHighlights(cells)
+			matchPositions := getMatchPositions(search, cells)
+
+			if len(cells) == 0 {
+				// Empty line
+				if skipRows > 0 {
+					skipRows--
+					isFirstRowOfLine = false
+				} else if screenY < current.height {
+					// Draw line number on first row
+					screenX := current.drawGutter(screenY, lineIndex, isFirstRowOfLine, marks)
+					isFirstRowOfLine = false
+					// Check if this row is in visual selection
+					inVisual := visual && a.isRowInVisualSelection(lineIndex, rowInLine, visualStartLine, visualStartOff, visualEndLine, visualEndOff)
+					if inVisual {
+						// Highlight empty row
+						for screenX < current.width {
+							current.setCell(screenX, screenY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+							screenX++
 						}
 					}
-					resultChan <- filterChunkResult{chunkIdx, chunkLines, chunkHasANSI, chunkIndices}
-				}(w, start, end)
-			}
-
-			// Collect results in order
-			results := make([]filterChunkResult, numWorkers)
-			received := 0
-			expectedWorkers := numWorkers
-			if totalLines < numWorkers {
-				expectedWorkers = 1
-			}
-			for i := 0; i < expectedWorkers && received < numWorkers; i++ {
-				result := <-resultChan
-				results[result.chunkIdx] = result
-				received++
-				if result.chunkIdx >= expectedWorkers {
-					break
+					if separator && lastRender {
+						current.underlineRow(screenY)
+					}
+					screenY++
 				}
-			}
-			close(resultChan)
-
-			// Drain any remaining
-			for range resultChan {
+				rowInLine++
+				continue
 			}
 
-			// Merge results in order and stream to viewer
-			foundMatch := false
-			matchesBefore := 0
-			lineCount := 0
-			var allIndices []int
-			var allHasANSI []bool
+			// Wrap the line across multiple screen rows
+			cellIdx := 0
+			for cellIdx < len(cells) {
+				if skipRows > 0 {
+					// Skip this wrapped row
+					skipRows--
+					// Advance cellIdx by one row's worth
+					cellIdx += wrapWidth
+					rowInLine++
+					isFirstRowOfLine = false
+					continue
+				}
+				if screenY >= current.height {
+					break
+				}
 
-			for chunkIdx := 0; chunkIdx < numWorkers; chunkIdx++ {
-				chunk := results[chunkIdx]
-				for j, line := range chunk.lines {
-					newViewer.mu.Lock()
-					newViewer.lines = append(newViewer.lines, line)
-					newViewer.hasANSI = append(newViewer.hasANSI, chunk.hasANSI[j])
-					newViewer.mu.Unlock()
+				// Check if this row is in visual selection
+				inVisual := visual && a.isRowInVisualSelection(lineIndex, rowInLine, visualStartLine, visualStartOff, visualEndLine, visualEndOff)
 
-					origIdx := chunk.indices[j]
-					allIndices = append(allIndices, origIdx)
-					allHasANSI = append(allHasANSI, chunk.hasANSI[j])
+				// Draw line number on first row of logical line
+				screenX := current.drawGutter(screenY, lineIndex, isFirstRowOfLine, marks)
+				isFirstRowOfLine = false
 
-					if origIdx >= currentTopLine && !foundMatch {
-						foundMatch = true
-						newViewer.topLine = matchesBefore
-					}
-					if !foundMatch {
-						matchesBefore++
+				for screenX < current.width && cellIdx < len(cells) {
+					cell := cells[cellIdx]
+					fg, bg := cell.fg, cell.bg
+					if matchPositions != nil && cellIdx < len(matchPositions) && matchPositions[cellIdx] {
+						fg = termbox.ColorBlack
+						bg = termbox.ColorYellow
+					} else if inVisual {
+						fg = termbox.ColorBlack
+						bg = termbox.ColorWhite
 					}
-
-					lineCount++
-					if lineCount <= 100 || lineCount%1000 == 0 {
-						termbox.Interrupt()
+					current.setCell(screenX, screenY, cell.char, fg, bg)
+					screenX++
+					cellIdx++
+				}
+				// Fill remaining with visual highlight if needed
+				if inVisual {
+					for screenX < current.width {
+						current.setCell(screenX, screenY, ' ', termbox.ColorBlack, termbox.ColorWhite)
+						screenX++
 					}
 				}
+				if separator && lastRender && cellIdx >= len(cells) {
+					current.underlineRow(screenY)
+				}
+				screenY++
+				rowInLine++
 			}
+		}
+		lineIndex++
+	}
+}
 
-			newViewer.mu.Lock()
-			newViewer.originIndices = allIndices
-			newViewer.loading = false
-			newViewer.mu.Unlock()
-			termbox.Interrupt()
-		}()
+// isRowInVisualSelection checks if a specific row (line + offset) is within visual selection
+func (a *App) isRowInVisualSelection(line, rowOffset, startLine, startOff, endLine, endOff int) bool {
+	if line < startLine || line > endLine {
+		return false
+	}
+	if line > startLine && line < endLine {
+		return true
+	}
+	if startLine == endLine {
+		return rowOffset >= startOff && rowOffset <= endOff
+	}
+	if line == startLine {
+		return rowOffset >= startOff
+	}
+	if line == endLine {
+		return rowOffset <= endOff
 	}
+	return false
 }
 
-// HandleFilterAppend appends matching lines from original
-func (a *App) HandleFilterAppend() {
-	current := a.stack.Current()
-	currentLine := current.GetLine(current.topLine)
+// getMatchPositions returns the positions of the matches of search for highlighting
+func getMatchPositions(search *SearchState, cells []ansiCell) []bool {
+	if search.query == "" {
+		return nil
+	}
 
-	query, isRegex, ignoreCase, ok := a.promptWithModifiers("+")
-	if ok && query != "" {
-		original := a.stack.viewers[0]
-		currentLines := current.GetLines()
-		originalLines := original.GetLines()
-		originalHasANSI := original.GetHasANSI()
+	matchPositions := make([]bool, len(cells))
+	plainText := make([]rune, len(cells))
+	for i, c := range cells {
+		plainText[i] = c.char
+	}
+	plainStr := string(plainText)
 
-		matcher, err := createMatcher(query, isRegex, ignoreCase)
-		if err != nil {
-			a.ShowTempMessage("Invalid regex: " + err.Error())
-			return
+	if search.regex != nil {
+		// Regex search - use regex for highlighting
+		matches := search.regex.FindAllStringIndex(plainStr, -1)
+		for _, match := range matches {
+			startRune := len([]rune(plainStr[:match[0]]))
+			endRune := len([]rune(plainStr[:match[1]]))
+			for j := startRune; j < endRune && j < len(matchPositions); j++ {
+				matchPositions[j] = true
+			}
 		}
-
-		// Create new viewer immediately with loading state
-		newViewer := &Viewer{
-			lines:    nil,
-			loading:  true,
-			filename: current.filename,
-			topLine:  0,
-			leftCol:  0,
+	} else if search.isExpr {
+		// Expression without terms to highlight
+		return nil
+	} else if search.ignoreCase {
+		// Case-insensitive literal search
+		lowerStr := strings.ToLower(plainStr)
+		lowerQuery := strings.ToLower(search.query)
+		queryLen := len([]rune(lowerQuery))
+		idx := 0
+		for {
+			pos := strings.Index(lowerStr[idx:], lowerQuery)
+			if pos == -1 {
+				break
+			}
+			// Convert byte position to rune position
+			runePos := len([]rune(lowerStr[:idx+pos]))
+			for j := runePos; j < runePos+queryLen && j < len(matchPositions); j++ {
+				matchPositions[j] = true
+			}
+			idx += pos + 1
 		}
-		a.stack.Push(newViewer)
-		a.search.Clear()
-
-		// Process in parallel
-		go func() {
-			// Build current counts map (sequential - usually small)
-			currentCounts := make(map[string]int)
-			for _, line := range currentLines {
-				currentCounts[line]++
-			}
-
-			// Parallel filtering of original lines
-			numWorkers := 8
-			totalLines := len(originalLines)
-			if totalLines < numWorkers {
-				numWorkers = 1
-			}
-			chunkSize := (totalLines + numWorkers - 1) / numWorkers
-
-			// For append, we need to track which current lines are used per chunk
-			// Each worker gets its own copy of counts for the lines in its chunk
-			type appendChunkResult struct {
-				chunkIdx int
-				lines    []string
-				hasANSI  []bool
-				indices  []int
-			}
-			resultChan := make(chan appendChunkResult, numWorkers)
-
-			// Pre-calculate which original lines match current lines (need order)
-			// First, mark lines that are in current
-			inCurrent := make([]bool, totalLines)
-			tempCounts := make(map[string]int)
-			for k, v := range currentCounts {
-				tempCounts[k] = v
-			}
-			for i, line := range originalLines {
-				if tempCounts[line] > 0 {
-					inCurrent[i] = true
-					tempCounts[line]--
-				}
+	} else {
+		// Case-sensitive literal search - use strings.Index
+		query := search.query
+		queryLen := len([]rune(query))
+		idx := 0
+		for {
+			pos := strings.Index(plainStr[idx:], query)
+			if pos == -1 {
+				break
 			}
+			// Convert byte position to rune position
+			runePos := len([]rune(plainStr[:idx+pos]))
+			for j := runePos; j < runePos+queryLen && j < len(matchPositions); j++ {
+				matchPositions[j] = true
+			}
+			idx += pos + 1
+		}
+	}
+	return matchPositions
+}
 
-			// Start workers - each checks if line is in current OR matches query
-			for w := 0; w < numWorkers; w++ {
-				start := w * chunkSize
-				end := start + chunkSize
-				if end > totalLines {
-					end = totalLines
-				}
-				if start >= totalLines {
-					break
-				}
-
-				go func(chunkIdx, start, end int) {
-					var chunkLines []string
-					var chunkHasANSI []bool
-					var chunkIndices []int
-					for i := start; i < end; i++ {
-						has := i < len(originalHasANSI) && originalHasANSI[i]
-						if inCurrent[i] || matcher(originalLines[i], has) {
-							chunkLines = append(chunkLines, originalLines[i])
-							chunkHasANSI = append(chunkHasANSI, has)
-							chunkIndices = append(chunkIndices, i)
-						}
-					}
-					resultChan <- appendChunkResult{chunkIdx, chunkLines, chunkHasANSI, chunkIndices}
-				}(w, start, end)
-			}
-
-			// Collect results in order
-			results := make([]appendChunkResult, numWorkers)
-			expectedWorkers := numWorkers
-			if totalLines < numWorkers {
-				expectedWorkers = 1
-			}
-			for i := 0; i < expectedWorkers; i++ {
-				result := <-resultChan
-				results[result.chunkIdx] = result
-			}
-			close(resultChan)
-
-			// Merge results in order and stream to viewer
-			foundCurrentLine := false
-			lineCount := 0
-			var allIndices []int
-
-			for chunkIdx := 0; chunkIdx < numWorkers; chunkIdx++ {
-				chunk := results[chunkIdx]
-				for j, line := range chunk.lines {
-					newViewer.mu.Lock()
-					newViewer.lines = append(newViewer.lines, line)
-					newViewer.hasANSI = append(newViewer.hasANSI, chunk.hasANSI[j])
-					if !foundCurrentLine && line == currentLine {
-						foundCurrentLine = true
-						newViewer.topLine = len(newViewer.lines) - 1
-					}
-					newViewer.mu.Unlock()
-
-					allIndices = append(allIndices, chunk.indices[j])
+// highlightRule colors the text matching a pattern in every view, on top of the
+// line's own colors and below search matches
+type highlightRule struct {
+	name       string
+	pattern    string
+	isRegex    bool
+	ignoreCase bool
+	color      string // As typed: fg or fg:bg
+	re         *regexp.Regexp
+	fg, bg     termbox.Attribute
+}
 
-					lineCount++
-					if lineCount <= 100 || lineCount%1000 == 0 {
-						termbox.Interrupt()
-					}
-				}
-			}
+// colorNames maps color names of highlight rules to termbox colors
+var colorNames = map[string]termbox.Attribute{
+	"default": termbox.ColorDefault,
+	"black":   termbox.ColorBlack,
+	"red":     termbox.ColorRed,
+	"green":   termbox.ColorGreen,
+	"yellow":  termbox.ColorYellow,
+	"blue":    termbox.ColorBlue,
+	"magenta": termbox.ColorMagenta,
+	"cyan":    termbox.ColorCyan,
+	"white":   termbox.ColorWhite,
+}
 
-			newViewer.mu.Lock()
-			newViewer.originIndices = allIndices
-			newViewer.loading = false
-			newViewer.mu.Unlock()
-			termbox.Interrupt()
-		}()
+// parseColor parses a color name or a 256 color number (0-255)
+func parseColor(s string) (termbox.Attribute, error) {
+	if c, ok := colorNames[strings.ToLower(s)]; ok {
+		return c, nil
 	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return 0, fmt.Errorf("unknown color %q", s)
+	}
+	return termbox.Attribute(n + 1), nil // termbox colors are 1-indexed
 }
 
-// HandleGotoLine prompts for a line number and jumps to it
-func (a *App) HandleGotoLine() {
-	current := a.stack.Current()
-	input, ok := current.promptForInput(":")
-	if ok && input != "" {
-		lineNum, err := strconv.Atoi(input)
-		if err != nil {
-			a.ShowTempMessage("Invalid line number")
-			return
-		}
-		// Convert to 0-based index
-		lineIdx := lineNum - 1
-		if lineIdx < 0 {
-			lineIdx = 0
-		}
-		maxLine := current.LineCount() - 1
-		if lineIdx > maxLine {
-			lineIdx = maxLine
+// newHighlightRule compiles a highlight rule. color is a foreground color, optionally
+// followed by ":" and a background color (red, black:yellow, 15:160).
+func newHighlightRule(name, pattern string, isRegex, ignoreCase bool, color string) (*highlightRule, error) {
+	r := &highlightRule{name: name, pattern: pattern, isRegex: isRegex, ignoreCase: ignoreCase, color: color}
+	fg, bg, hasBg := strings.Cut(color, ":")
+	var err error
+	if r.fg, err = parseColor(fg); err != nil {
+		return nil, err
+	}
+	if hasBg {
+		if r.bg, err = parseColor(bg); err != nil {
+			return nil, err
 		}
-		current.topLine = lineIdx
 	}
-}
 
-// HandleExport saves the current filtered view to a file
-func (a *App) HandleExport() {
-	current := a.stack.Current()
-	filename, ok := current.promptForInput(";")
-	if !ok || filename == "" {
-		return
+	expr := pattern
+	if !isRegex {
+		expr = regexp.QuoteMeta(pattern)
 	}
-
-	lines := current.GetLines()
-	content := strings.Join(lines, "\n")
-
-	err := os.WriteFile(filename, []byte(content), 0644)
-	if err != nil {
-		a.ShowTempMessage(fmt.Sprintf("Error: %v", err))
-		return
+	if ignoreCase {
+		expr = "(?i)" + expr
 	}
-
-	a.ShowTempMessage(fmt.Sprintf("Saved %d lines to %s", len(lines), filename))
+	if r.re, err = regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-// HandleStickyLeft prompts for the number of sticky left columns
-func (a *App) HandleStickyLeft() {
-	current := a.stack.Current()
-	input, ok := current.promptForInput("K (sticky cols): ")
-	if !ok {
-		return
+// flags returns the modifiers of the rule as written in the highlights file
+func (r *highlightRule) flags() string {
+	flags := ""
+	if r.isRegex {
+		flags += "r"
 	}
-	if input == "" {
-		// Empty input disables the feature
-		current.stickyLeft = 0
-		a.ShowTempMessage("Sticky left disabled")
-		return
-	}
-	num, err := strconv.Atoi(input)
-	if err != nil || num < 0 {
-		a.ShowTempMessage("Invalid number")
-		return
+	if r.ignoreCase {
+		flags += "i"
 	}
-	current.stickyLeft = num
-	if num > 0 {
-		a.ShowTempMessage(fmt.Sprintf("Sticky left: %d chars", num))
-	} else {
-		a.ShowTempMessage("Sticky left disabled")
+	if flags == "" {
+		flags = "-"
 	}
+	return flags
 }
 
-// ToggleFollow toggles follow mode for the root viewer
-func (a *App) ToggleFollow() {
-	// Follow mode only works on the root viewer
-	root := a.stack.viewers[0]
-	root.follow = !root.follow
-	if root.follow {
-		// Start following if not already
-		go root.followFile(root.filename)
-		// Jump to end
-		root.goToEnd()
-		a.ShowTempMessage("Follow mode ON")
-	} else {
-		a.ShowTempMessage("Follow mode OFF")
+// highlightLinePattern matches a line of the highlights file: name, color, flags, pattern
+var highlightLinePattern = regexp.MustCompile(`^(\S+)\s+(\S+)\s+([ri-]+)\s+(.+)$`)
+
+// highlightsPath returns the file highlight rules are kept in
+func highlightsPath() string {
+	return configPath("highlights")
+}
+
+// configPath returns the path of a file in the config directory ("" if there's none)
+func configPath(name string) string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
 	}
+	return filepath.Join(dir, "sieve", name)
 }
 
-// HandleSearch performs a search starting from current line
-// If backward is true, searches upward with "?" prompt; otherwise searches downward with "/" prompt
-func (a *App) HandleSearch(backward bool) {
-	current := a.stack.Current()
-	prompt := "/"
-	noMatchMsg := "EOF - no more matches"
-	if backward {
-		prompt = "?"
-		noMatchMsg = "BOF - no more matches"
+// loadHighlights reads highlight rules, one per line ("error red - ERROR"). Lines
+// starting with # and lines that don't parse are skipped.
+func loadHighlights(filename string) []*highlightRule {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
 	}
-
-	query, isRegex, ignoreCase, ok := a.promptWithModifiers(prompt)
-	if ok && query != "" {
-		lines := current.GetLines()
-		hasANSI := current.GetHasANSI()
-		lineIdx := a.search.Search(lines, hasANSI, query, current.topLine, backward, isRegex, ignoreCase)
-		if lineIdx >= 0 {
-			current.topLine = lineIdx
-		} else if a.search.HasResults() {
-			a.ShowTempMessage(noMatchMsg)
+	var rules []*highlightRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		m := highlightLinePattern.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := newHighlightRule(m[1], m[4], strings.Contains(m[3], "r"), strings.Contains(m[3], "i"), m[2])
+		if err == nil {
+			rules = append(rules, r)
 		}
 	}
+	return rules
 }
 
-// HandleSearchNav navigates search results
-// If reverse is false (n key): continues in search direction
-// If reverse is true (N key): goes opposite to search direction
-func (a *App) HandleSearchNav(reverse bool) {
-	if !a.search.HasResults() {
-		return
+// saveHighlights writes highlight rules in the format loadHighlights reads
+func saveHighlights(filename string, rules []*highlightRule) error {
+	var sb strings.Builder
+	sb.WriteString("# name color flags pattern\n")
+	for _, r := range rules {
+		fmt.Fprintf(&sb, "%s %s %s %s\n", r.name, r.color, r.flags(), r.pattern)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
 	}
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
 
-	current := a.stack.Current()
-	topLine := current.topLine
+// applyHighlights colors the cells matched by the highlight rules. Later rules win
+// where matches overlap.
+func (a *App) applyHighlights(cells []ansiCell) {
+	if len(a.highlights) == 0 || len(cells) == 0 {
+		return
+	}
+	plainText := make([]rune, len(cells))
+	for i, c := range cells {
+		plainText[i] = c.char
+	}
+	plainStr := string(plainText)
 
-	// Determine if we should go forward (down) or backward (up) in the file
-	goingUp := a.search.backward != reverse
+	for _, r := range a.highlights {
+		for _, match := range r.re.FindAllStringIndex(plainStr, -1) {
+			startRune := utf8.RuneCountInString(plainStr[:match[0]])
+			endRune := startRune + utf8.RuneCountInString(plainStr[match[0]:match[1]])
+			for j := startRune; j < endRune && j < len(cells); j++ {
+				cells[j].fg = r.fg
+				if r.bg != termbox.ColorDefault {
+					cells[j].bg = r.bg
+				}
+			}
+		}
+	}
+}
 
-	if goingUp {
-		// Find the last match BEFORE topLine
-		found := false
-		for i := len(a.search.matches) - 1; i >= 0; i-- {
-			if a.search.matches[i] < topLine {
-				current.topLine = a.search.matches[i]
-				a.search.current = i
-				found = true
-				break
+// HandleHighlights shows the highlight rules in a panel where they can be added,
+// edited, moved and deleted. Changes are saved to the highlights file.
+func (a *App) HandleHighlights() {
+	selected := 0
+	message := ""
+	for {
+		rows := make([]panelRow, len(a.highlights))
+		for i, r := range a.highlights {
+			text := fmt.Sprintf("%-12s ", r.name)
+			if r.isRegex {
+				text += "[regex] "
 			}
+			if r.ignoreCase {
+				text += "[nocase] "
+			}
+			rows[i] = panelRow{text: text + r.pattern, info: r.color, fg: r.fg, bg: r.bg}
 		}
-		if !found {
-			a.ShowTempMessage("BOF")
+		footer := "a:add  e:edit  J/K:move  d:delete  q:close"
+		if message != "" {
+			footer = message
 		}
-	} else {
-		// Find the first match AFTER topLine
-		found := false
-		for i, lineIdx := range a.search.matches {
-			if lineIdx > topLine {
-				current.topLine = lineIdx
-				a.search.current = i
-				found = true
-				break
+		a.drawPanel("Highlights", rows, selected, footer)
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+
+		changed := false
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'c':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, max(len(a.highlights)-1, 0))
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case ev.Ch == 'a':
+			r, err := a.promptHighlight(&highlightRule{color: "black:yellow"})
+			if err != nil {
+				message = err.Error()
+			} else if r != nil {
+				a.highlights = append(a.highlights, r)
+				selected = len(a.highlights) - 1
+				changed = true
+			}
+		case len(a.highlights) == 0:
+			// Nothing to change
+		case ev.Key == termbox.KeyEnter || ev.Ch == 'e':
+			r, err := a.promptHighlight(a.highlights[selected])
+			if err != nil {
+				message = err.Error()
+			} else if r != nil {
+				a.highlights[selected] = r
+				changed = true
 			}
+		case ev.Ch == 'J' && selected < len(a.highlights)-1:
+			a.highlights[selected], a.highlights[selected+1] = a.highlights[selected+1], a.highlights[selected]
+			selected++
+			changed = true
+		case ev.Ch == 'K' && selected > 0:
+			a.highlights[selected], a.highlights[selected-1] = a.highlights[selected-1], a.highlights[selected]
+			selected--
+			changed = true
+		case ev.Ch == 'd' || ev.Ch == 'x':
+			a.highlights = append(a.highlights[:selected], a.highlights[selected+1:]...)
+			selected = max(min(selected, len(a.highlights)-1), 0)
+			changed = true
 		}
-		if !found {
-			a.ShowTempMessage("EOF")
+
+		if changed {
+			message = ""
+			if err := saveHighlights(highlightsPath(), a.highlights); err != nil {
+				message = "Couldn't save highlights: " + err.Error()
+			}
 		}
 	}
 }
 
-// HandleStackNav navigates the viewer stack
-// If reset is true (=), resets to first viewer; if false (^U), pops one level
-func (a *App) HandleStackNav(reset bool) {
-	current := a.stack.Current()
-	topLine := current.topLine
-
-	// Get the target line index in the parent/original viewer
-	var targetLine int
-	if len(current.originIndices) > 0 && topLine < len(current.originIndices) {
-		targetLine = current.originIndices[topLine]
-	} else {
-		targetLine = topLine
+// promptHighlight prompts for the name, pattern and color of a highlight rule, starting
+// from r. Returns nil if a prompt was cancelled.
+func (a *App) promptHighlight(r *highlightRule) (*highlightRule, error) {
+	a.Draw()
+	v := a.stack.Current()
+	name, ok := v.editInput("Highlight name: ", r.name)
+	if !ok || name == "" {
+		return nil, nil
 	}
+	// The name is the first word of a line in the highlights file
+	name = strings.Join(strings.Fields(name), "_")
 
-	// For reset, we need to trace back through all viewers to find original index
-	if reset && len(a.stack.viewers) > 1 {
-		// Walk up the stack to find the original line number
-		for i := len(a.stack.viewers) - 1; i >= 1; i-- {
-			v := a.stack.viewers[i]
-			if len(v.originIndices) > 0 && targetLine < len(v.originIndices) {
-				targetLine = v.originIndices[targetLine]
-			}
-		}
+	pattern, isRegex, ignoreCase, _, ok := a.editWithModifiers("Pattern: ", r.pattern, r.isRegex, r.ignoreCase, false)
+	if !ok || pattern == "" {
+		return nil, nil
 	}
-
-	var changed bool
-	if reset {
-		changed = a.stack.Reset()
-	} else {
-		changed = a.stack.Pop()
+	color, ok := v.editInput("Color (fg or fg:bg, name or 0-255): ", r.color)
+	if !ok || color == "" {
+		return nil, nil
 	}
+	return newHighlightRule(name, pattern, isRegex, ignoreCase, color)
+}
 
-	if changed {
-		newCurrent := a.stack.Current()
-		newCurrent.topLineOffset = 0
+// logLevel is the severity of a log line
+type logLevel int
+
+const (
+	levelNone logLevel = iota // No level found
+	levelTrace
+	levelDebug
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
 
-		// If newCurrent has originIndices, find closest line using binary search
-		if len(newCurrent.originIndices) > 0 {
-			// Binary search for the target line or closest below it
-			idx := sort.Search(len(newCurrent.originIndices), func(i int) bool {
-				return newCurrent.originIndices[i] >= targetLine
-			})
-			if idx < len(newCurrent.originIndices) {
-				newCurrent.topLine = idx
-			} else if len(newCurrent.originIndices) > 0 {
-				newCurrent.topLine = len(newCurrent.originIndices) - 1
-			}
-		} else {
-			// No originIndices (original file), just use the target line clamped to bounds
-			lineCount := newCurrent.LineCount()
-			if targetLine >= lineCount {
-				newCurrent.topLine = lineCount - 1
-			} else {
-				newCurrent.topLine = targetLine
-			}
-		}
-	}
-	a.search.Clear()
+// levelNames maps level words (lower case) to levels
+var levelNames = map[string]logLevel{
+	"trace":       levelTrace,
+	"debug":       levelDebug,
+	"dbg":         levelDebug,
+	"info":        levelInfo,
+	"information": levelInfo,
+	"notice":      levelInfo,
+	"warn":        levelWarn,
+	"warning":     levelWarn,
+	"error":       levelError,
+	"err":         levelError,
+	"severe":      levelError,
+	"fatal":       levelFatal,
+	"critical":    levelFatal,
+	"crit":        levelFatal,
+	"panic":       levelFatal,
+	"alert":       levelFatal,
+	"emerg":       levelFatal,
 }
 
-// Draw renders the current view
-func (a *App) Draw() {
-	current := a.stack.Current()
-	current.resize(termbox.Size())
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+// levelKeys are the field names holding the level in JSON and logfmt lines
+var levelKeys = map[string]bool{"level": true, "lvl": true, "severity": true, "loglevel": true}
 
-	lineCount := current.LineCount()
+// levelScanLimit is how far into a line the level is looked for
+const levelScanLimit = 300
 
-	if current.wordWrap || current.jsonPretty {
-		a.drawWrapped(current, lineCount)
-	} else {
-		a.drawNormal(current, lineCount)
+// String returns the name levels are shown and entered with
+func (l logLevel) String() string {
+	return [...]string{"none", "trace", "debug", "info", "warn", "error", "fatal"}[l]
+}
+
+// parseLevel parses a level name as entered in prompts
+func parseLevel(s string) (logLevel, bool) {
+	l, ok := levelNames[strings.ToLower(strings.TrimSpace(s))]
+	return l, ok
+}
+
+// detectLevel finds the level of a line without ANSI codes: a syslog priority (<3>),
+// a level field (level=warn, "level":"warn", "level":40), an upper case level word
+// (ERROR, WARN) or a lower case one in brackets ([error]). The first one wins.
+func detectLevel(line string) logLevel {
+	if len(line) > levelScanLimit {
+		line = line[:levelScanLimit]
 	}
 
-	if a.visualMode {
-		// Visual mode status bar
-		startLine := a.visualStart
-		endLine := a.visualCursor
-		if startLine > endLine {
-			startLine, endLine = endLine, startLine
+	// Syslog priority: facility*8 + severity
+	if strings.HasPrefix(line, "<") {
+		if end := strings.IndexByte(line, '>'); end > 1 && end <= 4 {
+			if pri, err := strconv.Atoi(line[1:end]); err == nil {
+				return [...]logLevel{levelFatal, levelFatal, levelFatal, levelError, levelWarn, levelInfo, levelInfo, levelDebug}[pri%8]
+			}
 		}
-		status := fmt.Sprintf(" VISUAL: Line %d/%d | Marked %d-%d ",
-			a.visualCursor+1, current.LineCount(), startLine+1, endLine+1)
-		a.drawVisualStatusBar(current, status)
-		termbox.Flush()
-	} else if a.statusMessage != "" && time.Now().Before(a.messageExpiry) {
-		current.showMessage(a.statusMessage)
-	} else {
-		a.statusMessage = ""
-		// Calculate original line number by tracing through the stack
-		origLine := current.topLine
-		for i := len(a.stack.viewers) - 1; i >= 1; i-- {
-			v := a.stack.viewers[i]
-			if len(v.originIndices) > 0 && origLine < len(v.originIndices) {
-				origLine = v.originIndices[origLine]
+	}
+
+	for i := 0; i < len(line); {
+		if !isLetter(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && isLetter(line[i]) {
+			i++
+		}
+		word := line[start:i]
+		lower := strings.ToLower(word)
+
+		if levelKeys[lower] {
+			if l := levelValue(line[i:]); l != levelNone {
+				return l
 			}
+			continue
 		}
-		origTotal := a.stack.viewers[0].LineCount()
-		
-		// Add search info if there are results
-		searchInfo := ""
-		if a.search.HasResults() {
-			searchInfo = fmt.Sprintf(" | Search: %d/%d", a.search.current+1, len(a.search.matches))
+		l, ok := levelNames[lower]
+		if !ok {
+			continue
+		}
+		if word == strings.ToUpper(word) {
+			return l
+		}
+		if start > 0 && line[start-1] == '[' && i < len(line) && line[i] == ']' {
+			return l
 		}
-		a.drawStatusBarWithSearch(current, len(a.stack.viewers), origLine, origTotal, searchInfo)
-		termbox.Flush()
 	}
+	return levelNone
 }
 
-// drawNormal renders without word wrap
-// getLineNumWidth returns the width needed for line numbers
-func (v *Viewer) getLineNumWidth() int {
-	if !v.showLineNumbers {
-		return 0
+// levelValue parses the value after a level key: ="warn", : "warn", =WARN or a
+// numeric level ("level":40, as logged by pino and bunyan)
+func levelValue(s string) logLevel {
+	s = strings.TrimLeft(s, `"' `)
+	if s == "" || (s[0] != '=' && s[0] != ':') {
+		return levelNone
 	}
-	// Calculate digits needed for max line number
-	maxLine := v.LineCount()
-	digits := 1
-	for maxLine >= 10 {
-		maxLine /= 10
-		digits++
+	s = strings.TrimLeft(s[1:], `"' `)
+	end := 0
+	for end < len(s) && (isLetter(s[end]) || s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	if n, err := strconv.Atoi(s[:end]); err == nil {
+		switch {
+		case n >= 60:
+			return levelFatal
+		case n >= 50:
+			return levelError
+		case n >= 40:
+			return levelWarn
+		case n >= 30:
+			return levelInfo
+		case n >= 20:
+			return levelDebug
+		default:
+			return levelTrace
+		}
 	}
-	return digits + 1 // +1 for separator space
+	return levelNames[strings.ToLower(s[:end])]
 }
 
-func (a *App) drawNormal(current *Viewer, lineCount int) {
-	screenY := 0
-	lineIndex := current.topLine
-	skipRows := current.topLineOffset // Skip this many rows at start
+// isLetter reports whether b is an ASCII letter
+func isLetter(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
 
-	// Pastel blue color (using 256-color mode: color 117 is a light blue)
-	stickyFg := termbox.Attribute(117 + 1) // +1 because termbox uses 1-indexed colors
+// lineLevel returns the level of line i of src
+func lineLevel(src lineSource, i int) logLevel {
+	line := src.Line(i)
+	if src.HasANSI(i) {
+		line = stripANSI(line)
+	}
+	return detectLevel(line)
+}
 
-	// Line number width (0 if disabled)
-	lineNumWidth := current.getLineNumWidth()
-	lineNumFg := termbox.Attribute(244) // Gray color for line numbers
+// levelColor returns the color lines of a level are tinted with (default for none)
+func levelColor(l logLevel) termbox.Attribute {
+	switch l {
+	case levelTrace, levelDebug:
+		return termbox.Attribute(245 + 1) // Gray
+	case levelWarn:
+		return termbox.ColorYellow
+	case levelError:
+		return termbox.ColorRed
+	case levelFatal:
+		return termbox.ColorRed | termbox.AttrBold
+	}
+	return termbox.ColorDefault
+}
 
-	// Calculate effective sticky columns
-	stickyActive := current.stickyLeft > 0
-	stickyWidth := current.stickyLeft
-	if stickyActive && stickyWidth > current.width/2 {
-		stickyWidth = current.width / 2 // Cap at half screen
+// levelOf returns the level of a line to tint it with, none if tinting is off
+func (a *App) levelOf(line string) logLevel {
+	if !a.levelColors {
+		return levelNone
+	}
+	if lineHasANSI(line) {
+		line = stripANSI(line)
 	}
+	return detectLevel(line)
+}
 
-	// Visual selection range
-	var visualStart, visualEnd int
-	if a.visualMode {
-		visualStart = a.visualStart
-		visualEnd = a.visualCursor
-		if visualStart > visualEnd {
-			visualStart, visualEnd = visualEnd, visualStart
+// tintLevel colors the cells of a line with the color of its level, leaving text the
+// line colors itself alone
+func (a *App) tintLevel(cells []ansiCell, l logLevel) {
+	fg := levelColor(l)
+	if fg == termbox.ColorDefault {
+		return
+	}
+	for i := range cells {
+		if cells[i].fg == termbox.ColorDefault {
+			cells[i].fg = fg
 		}
 	}
+}
 
-	for screenY < current.height && lineIndex < lineCount {
-		line := current.GetLine(lineIndex)
+// HandleLevelFilter keeps lines at or above a level. Lines that continue an entry
+// (stack traces, multi-line messages) have the level of the entry.
+func (a *App) HandleLevelFilter() {
+	input, ok := a.stack.Current().promptForInput("! (level at least): ")
+	if !ok || input == "" {
+		return
+	}
+	a.pushFilter(&filterSpec{op: '!', query: input})
+}
 
-		// Check if this line is in visual selection
-		inVisualSelection := a.visualMode && lineIndex >= visualStart && lineIndex <= visualEnd
+// newLevelView creates a view of current with the entries at or above the level of spec
+func (a *App) newLevelView(current *Viewer, spec *filterSpec, topLine int) (*Viewer, error) {
+	// ">= warn" reads better in the filter stack, so it's allowed too
+	minLevel, ok := parseLevel(strings.TrimPrefix(strings.TrimSpace(spec.query), ">="))
+	if !ok {
+		return nil, fmt.Errorf("Unknown level %q (trace, debug, info, warn, error, fatal)", spec.query)
+	}
 
-		// Expand JSON if enabled
-		var linesToRender []string
-		if current.jsonPretty && isJSON(line) {
-			linesToRender = formatJSON(line)
-		} else {
-			linesToRender = []string{line}
-		}
+	// Entries are split like records: with the record rule if record mode is on,
+	// otherwise by indentation and timestamps
+	src := current.Snapshot()
+	records := current.root().records
+	if records == nil {
+		records = &recordRule{}
+	}
+	records = records.forSource(src, a.timestampFormat)
 
-		isFirstRow := true
-		for _, renderLine := range linesToRender {
-			if skipRows > 0 {
-				skipRows--
-				isFirstRow = false
-				continue
-			}
-			if screenY >= current.height {
-				break
+	// Lines are matched in order, continuation lines get the level of their entry.
+	// Only this view's own updates run match, one at a time (+ views keep its lines by index).
+	level := levelNone
+	match := func(line string, hasANSI bool) bool {
+		if records.isStart(line) {
+			if hasANSI {
+				line = stripANSI(line)
 			}
+			level = detectLevel(line)
+		}
+		return level >= minLevel
+	}
 
-			cells := parseANSI(renderLine)
-			matchPositions := a.getMatchPositions(cells)
+	newViewer := &Viewer{
+		parent:   current,
+		loading:  true,
+		filename: current.filename,
+		match:    match,
+		filter:   spec,
+	}
+	current.subscribe(newViewer)
+	go newViewer.scanLines(src, topLine)
+	return newViewer, nil
+}
 
-			screenX := 0
+// HandleSetJumpLevel prompts for the lowest level e/E jump to
+func (a *App) HandleSetJumpLevel() {
+	input, ok := a.stack.Current().promptForInput(fmt.Sprintf("V (jump level, now %s): ", a.jumpLevel))
+	if !ok || input == "" {
+		return
+	}
+	l, ok := parseLevel(input)
+	if !ok {
+		a.ShowTempMessage("Unknown level (trace, debug, info, warn, error, fatal)")
+		return
+	}
+	a.jumpLevel = l
+	a.ShowTempMessage(fmt.Sprintf("e/E jump to %s and above", l))
+}
 
-			// Draw line number (only on first row of logical line)
-			if lineNumWidth > 0 {
-				if isFirstRow {
-					lineNumStr := fmt.Sprintf("%*d ", lineNumWidth-1, lineIndex+1)
-					for _, ch := range lineNumStr {
-						termbox.SetCell(screenX, screenY, ch, lineNumFg, termbox.ColorDefault)
-						screenX++
-					}
-				} else {
-					// Fill with spaces for continuation rows
-					for i := 0; i < lineNumWidth; i++ {
-						termbox.SetCell(screenX, screenY, ' ', termbox.ColorDefault, termbox.ColorDefault)
-						screenX++
-					}
-				}
-			}
-			isFirstRow = false
+// HandleLevelJump moves to the next (or previous if backward) line at or above the
+// jump level
+func (a *App) HandleLevelJump(backward bool) {
+	current := a.stack.Current()
+	src := current.Snapshot()
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := current.topLine + step; i >= 0 && i < src.Len(); i += step {
+		if lineLevel(src, i) >= a.jumpLevel {
+			current.topLine = i
+			current.topLineOffset = 0
+			return
+		}
+	}
+	a.ShowTempMessage(fmt.Sprintf("No more %s lines", a.jumpLevel))
+}
 
-			// Visual selection background color
-			visualBg := termbox.Attribute(239) // Dark gray for selection
+// templateValues matches the parts of a line that vary between lines logged by the
+// same statement: UUIDs, IP addresses, hex ids and numbers
+const templateValues = `(\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b)|` +
+	`(\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b)|` +
+	`(\b(?:0x[0-9a-fA-F]+|[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*|[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*)\b)|` +
+	`(\d+(?:\.\d+)*)`
+
+var (
+	// templateTokenPattern also masks quoted strings. JSON lines use templateJSONPattern,
+	// since their messages are quoted and the tokens are looked for inside them.
+	templateTokenPattern = regexp.MustCompile(`("[^"]*")|` + templateValues)
+	templateJSONPattern  = regexp.MustCompile(templateValues)
+)
 
-			if stickyActive {
-				// Draw sticky left columns in pastel blue
-				for i := 0; i < stickyWidth && i < len(cells); i++ {
-					if screenX >= current.width {
-						break
-					}
-					fg := stickyFg
-					bg := termbox.ColorDefault
-					if inVisualSelection {
-						bg = visualBg
-					}
-					// Preserve search highlighting even in sticky area
-					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
-						fg = termbox.ColorBlack
-						bg = termbox.ColorYellow
-					}
-					termbox.SetCell(screenX, screenY, cells[i].char, fg, bg)
-					screenX++
-				}
+// templateTokens are the placeholders of the groups of templateTokenPattern, and the
+// patterns matching what they replaced
+var templateTokens = []struct{ placeholder, pattern string }{
+	{"<STR>", `"[^"\n]*"`},
+	{"<UUID>", `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`},
+	{"<IP>", `\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?`},
+	{"<HEX>", `(?:0x)?[0-9a-fA-F]+`},
+	{"<NUM>", `\d+(?:\.\d+)*`},
+}
+
+// maskTokens splits a line without ANSI codes into the literal text and the variable
+// tokens (indices into templateTokens) of its template
+func maskTokens(line string, literal func(string), token func(kind int)) {
+	pattern, first := templateTokenPattern, 0
+	if isJSON(line) {
+		pattern, first = templateJSONPattern, 1
+	}
+	last := 0
+	for _, m := range pattern.FindAllStringSubmatchIndex(line, -1) {
+		kind := 0
+		for m[2+2*kind] < 0 {
+			kind++
+		}
+		kind += first
+		if m[0] > last {
+			literal(line[last:m[0]])
+		}
+		token(kind)
+		last = m[1]
+	}
+	if last < len(line) {
+		literal(line[last:])
+	}
+}
 
+// templateOf returns the template of a line, with its variable tokens masked
+func templateOf(line string) string {
+	var sb strings.Builder
+	maskTokens(line, func(s string) { sb.WriteString(s) }, func(kind int) {
+		sb.WriteString(templateTokens[kind].placeholder)
+	})
+	return sb.String()
+}
 
-				// Draw the rest of the line starting from leftCol (or after sticky if not scrolled)
-				startCol := current.leftCol
-				if current.leftCol == 0 {
-					startCol = stickyWidth // Skip sticky chars that were already drawn
+// templatePattern returns a regex matching the lines with the template of line. It's
+// anchored at line boundaries, so in record mode it matches records with such a line.
+func templatePattern(line string) string {
+	var sb strings.Builder
+	sb.WriteString("(?m)^")
+	maskTokens(line, func(s string) { sb.WriteString(regexp.QuoteMeta(s)) }, func(kind int) {
+		sb.WriteString(templateTokens[kind].pattern)
+	})
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// valueCount counts the lines with a value (a template, the value of a field)
+type valueCount struct {
+	value string
+	count int
+	first int // First line with the value
+}
+
+// countValues counts the lines of src (without ANSI codes) by the value key returns for
+// them, in parallel, most common first. Lines key returns false for are skipped.
+func countValues(src lineSource, key func(line string) (string, bool)) []*valueCount {
+	numWorkers := 8
+	totalLines := src.Len()
+	if totalLines < numWorkers {
+		numWorkers = 1
+	}
+	chunkSize := (totalLines + numWorkers - 1) / numWorkers
+
+	chunks := make([]map[string]*valueCount, numWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			counts := make(map[string]*valueCount)
+			for i := w * chunkSize; i < min((w+1)*chunkSize, totalLines); i++ {
+				line := src.Line(i)
+				if src.HasANSI(i) {
+					line = stripANSI(line)
 				}
-				for i := startCol; i < len(cells); i++ {
-					if screenX >= current.width {
-						break
-					}
-					fg, bg := cells[i].fg, cells[i].bg
-					if inVisualSelection {
-						bg = visualBg
-					}
-					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
-						fg = termbox.ColorBlack
-						bg = termbox.ColorYellow
-					}
-					termbox.SetCell(screenX, screenY, cells[i].char, fg, bg)
-					screenX++
+				value, ok := key(line)
+				if !ok {
+					continue
 				}
-				// Fill rest of line with selection color if in visual mode
-				if inVisualSelection {
-					for screenX < current.width {
-						termbox.SetCell(screenX, screenY, ' ', termbox.ColorDefault, visualBg)
-						screenX++
-					}
+				if c, ok := counts[value]; ok {
+					c.count++
+				} else {
+					counts[value] = &valueCount{value: value, count: 1, first: i}
 				}
+			}
+			chunks[w] = counts
+		}(w)
+	}
+	wg.Wait()
+
+	// Earlier chunks come first, so the first line of a value is from the first chunk with it
+	merged := make(map[string]*valueCount)
+	var result []*valueCount
+	for _, counts := range chunks {
+		for value, c := range counts {
+			if m, ok := merged[value]; ok {
+				m.count += c.count
+				m.first = min(m.first, c.first)
 			} else {
-				// Normal rendering (no sticky)
-				for i, cell := range cells {
-					if i < current.leftCol {
-						continue
-					}
-					if screenX >= current.width {
-						break
-					}
-					fg, bg := cell.fg, cell.bg
-					if inVisualSelection {
-						bg = visualBg
-					}
-					if matchPositions != nil && i < len(matchPositions) && matchPositions[i] {
-						fg = termbox.ColorBlack
-						bg = termbox.ColorYellow
-					}
-					termbox.SetCell(screenX, screenY, cell.char, fg, bg)
-					screenX++
-				}
-				// Fill rest of line with selection color if in visual mode
-				if inVisualSelection {
-					for screenX < current.width {
-						termbox.SetCell(screenX, screenY, ' ', termbox.ColorDefault, visualBg)
-						screenX++
-					}
-				}
+				merged[value] = c
+				result = append(result, c)
 			}
-			screenY++
 		}
-		lineIndex++
 	}
+	sortByCount(result)
+	return result
 }
 
-// drawWrapped renders with word wrap
-func (a *App) drawWrapped(current *Viewer, lineCount int) {
-	screenY := 0
-	lineIndex := current.topLine
-	skipRows := current.topLineOffset // Skip this many rows at start
-	rowInLine := 0                    // Current row within the logical line
+// sortByCount sorts values most common first, then by their first line
+func sortByCount(values []*valueCount) {
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return values[i].first < values[j].first
+	})
+}
 
-	// Line number width (0 if disabled)
-	lineNumWidth := current.getLineNumWidth()
-	lineNumFg := termbox.Attribute(244) // Gray color for line numbers
-	wrapWidth := current.width - lineNumWidth
+// HandleTemplates groups the lines of the current view by template, the line with its
+// numbers, ids and quoted strings masked, and lists the templates by count. The
+// selected template can be kept or excluded as a regex filter.
+func (a *App) HandleTemplates() {
+	current := a.stack.Current()
+	src := current.Snapshot()
+	a.ShowTempMessage("Clustering...")
+	a.Draw()
+	templates := countValues(src, func(line string) (string, bool) { return templateOf(line), true })
+	a.ClearMessage()
 
-	// Visual selection range (line and offset)
-	var visualStartLine, visualStartOff, visualEndLine, visualEndOff int
-	if a.visualMode {
-		visualStartLine = a.visualStart
-		visualStartOff = a.visualStartOffset
-		visualEndLine = a.visualCursor
-		visualEndOff = a.visualCursorOffset
-		// Ensure start <= end
-		if visualStartLine > visualEndLine || (visualStartLine == visualEndLine && visualStartOff > visualEndOff) {
-			visualStartLine, visualEndLine = visualEndLine, visualStartLine
-			visualStartOff, visualEndOff = visualEndOff, visualStartOff
-		}
+	rows := make([]panelRow, len(templates))
+	for i, t := range templates {
+		info := fmt.Sprintf("%d (%.1f%%)", t.count, float64(t.count)*100/float64(src.Len()))
+		rows[i] = panelRow{text: t.value, info: info}
 	}
+	title := fmt.Sprintf("Patterns (%d)", len(templates))
 
-	for screenY < current.height && lineIndex < lineCount {
-		line := current.GetLine(lineIndex)
+	selected := 0
+	for {
+		a.drawPanel(title, rows, selected, "&/Enter:keep  -:exclude  g:go to first  q:close")
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
 
-		// Expand JSON if enabled
-		var linesToRender []string
-		if current.jsonPretty && isJSON(line) {
-			linesToRender = formatJSON(line)
-		} else {
-			linesToRender = []string{line}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'p':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, max(len(rows)-1, 0))
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeyCtrlD:
+			selected = min(selected+10, max(len(rows)-1, 0))
+		case ev.Key == termbox.KeyPgup || ev.Key == termbox.KeyCtrlU:
+			selected = max(selected-10, 0)
+		case len(templates) == 0:
+			// Nothing to act on
+		case ev.Ch == 'g':
+			current.topLine = templates[selected].first
+			current.topLineOffset = 0
+			return
+		case ev.Key == termbox.KeyEnter || ev.Ch == '&' || ev.Ch == '-':
+			op := byte('&')
+			if ev.Ch == '-' {
+				op = '-'
+			}
+			line := src.Line(templates[selected].first)
+			if src.HasANSI(templates[selected].first) {
+				line = stripANSI(line)
+			}
+			a.pushFilter(&filterSpec{op: op, query: templatePattern(line), isRegex: true})
+			return
 		}
+	}
+}
 
-		rowInLine = 0
-		isFirstRowOfLine := true
-		for _, renderLine := range linesToRender {
-			cells := parseANSI(renderLine)
-			matchPositions := a.getMatchPositions(cells)
+// fieldExtractor gets the value of a field from lines for the field values panel
+type fieldExtractor struct {
+	value  func(line string) (string, bool)
+	filter func(value string) *filterSpec // Keeps the lines with the value
+}
 
-			if len(cells) == 0 {
-				// Empty line
-				if skipRows > 0 {
-					skipRows--
-					isFirstRowOfLine = false
-				} else if screenY < current.height {
-					screenX := 0
-					// Draw line number on first row
-					if lineNumWidth > 0 {
-						if isFirstRowOfLine {
-							lineNumStr := fmt.Sprintf("%*d ", lineNumWidth-1, lineIndex+1)
-							for _, ch := range lineNumStr {
-								termbox.SetCell(screenX, screenY, ch, lineNumFg, termbox.ColorDefault)
-								screenX++
-							}
-						} else {
-							for i := 0; i < lineNumWidth; i++ {
-								termbox.SetCell(screenX, screenY, ' ', termbox.ColorDefault, termbox.ColorDefault)
-								screenX++
-							}
-						}
-					}
-					isFirstRowOfLine = false
-					// Check if this row is in visual selection
-					inVisual := a.visualMode && a.isRowInVisualSelection(lineIndex, rowInLine, visualStartLine, visualStartOff, visualEndLine, visualEndOff)
-					if inVisual {
-						// Highlight empty row
-						for screenX < current.width {
-							termbox.SetCell(screenX, screenY, ' ', termbox.ColorBlack, termbox.ColorWhite)
-							screenX++
-						}
-					}
-					screenY++
+// newFieldExtractor parses the field of the field values panel: a JSON path (.a.b),
+// a /regex/ whose first group (or whole match) is the value, or a name, which is a
+// logfmt key or else a top level JSON field
+func newFieldExtractor(field string) (*fieldExtractor, error) {
+	switch {
+	case len(field) > 2 && strings.HasPrefix(field, "/") && strings.HasSuffix(field, "/"):
+		pattern := field[1 : len(field)-1]
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		group := min(re.NumSubexp(), 1)
+		return &fieldExtractor{
+			value: func(line string) (string, bool) {
+				m := re.FindStringSubmatchIndex(line)
+				if m == nil || m[2*group] < 0 {
+					return "", false
 				}
-				rowInLine++
-				continue
-			}
+				return line[m[2*group]:m[2*group+1]], true
+			},
+			filter: func(value string) *filterSpec {
+				return &filterSpec{query: replaceFirstGroup(pattern, value), isRegex: true}
+			},
+		}, nil
 
-			// Wrap the line across multiple screen rows
-			cellIdx := 0
-			for cellIdx < len(cells) {
-				if skipRows > 0 {
-					// Skip this wrapped row
-					skipRows--
-					// Advance cellIdx by one row's worth
-					cellIdx += wrapWidth
-					rowInLine++
-					isFirstRowOfLine = false
-					continue
+	case strings.HasPrefix(field, "."):
+		path := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(field[1:]), ".")
+		return &fieldExtractor{
+			value: func(line string) (string, bool) {
+				value, ok := lookupJSON(parseJSONObject(line), path)
+				if !ok {
+					return "", false
 				}
-				if screenY >= current.height {
-					break
+				return jsonText(value), true
+			},
+			filter: func(value string) *filterSpec {
+				return &filterSpec{query: field + " == " + exprQuote(value), isExpr: true}
+			},
+		}, nil
+	}
+
+	if !keyComparePattern.MatchString(field + "=") {
+		return nil, fmt.Errorf("Invalid field %q", field)
+	}
+	return &fieldExtractor{
+		value: func(line string) (string, bool) {
+			if fields, err := parseLogfmt(line); err == nil {
+				if value, ok := fields[field]; ok {
+					return value, true
 				}
+			}
+			if value, ok := lookupJSON(parseJSONObject(line), []string{field}); ok {
+				return jsonText(value), true
+			}
+			return "", false
+		},
+		filter: func(value string) *filterSpec {
+			quoted := exprQuote(value)
+			return &filterSpec{query: field + "=" + quoted + " || ." + field + " == " + quoted, isExpr: true}
+		},
+	}, nil
+}
 
-				// Check if this row is in visual selection
-				inVisual := a.visualMode && a.isRowInVisualSelection(lineIndex, rowInLine, visualStartLine, visualStartOff, visualEndLine, visualEndOff)
+// exprQuote quotes a value for a filter expression
+func exprQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
 
-				screenX := 0
+// replaceFirstGroup returns pattern with its first capture group matching only value,
+// or value alone if pattern has no group
+func replaceFirstGroup(pattern, value string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return regexp.QuoteMeta(value)
+	}
+	literal, _ := syntax.Parse(regexp.QuoteMeta(value), syntax.Perl)
+	var replace func(re *syntax.Regexp) bool
+	replace = func(re *syntax.Regexp) bool {
+		if re.Op == syntax.OpCapture && re.Cap == 1 {
+			re.Sub = []*syntax.Regexp{literal}
+			return true
+		}
+		for _, sub := range re.Sub {
+			if replace(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	if !replace(re) {
+		return regexp.QuoteMeta(value)
+	}
+	return re.String()
+}
 
-				// Draw line number on first row of logical line
-				if lineNumWidth > 0 {
-					if isFirstRowOfLine {
-						lineNumStr := fmt.Sprintf("%*d ", lineNumWidth-1, lineIndex+1)
-						for _, ch := range lineNumStr {
-							termbox.SetCell(screenX, screenY, ch, lineNumFg, termbox.ColorDefault)
-							screenX++
-						}
-					} else {
-						for i := 0; i < lineNumWidth; i++ {
-							termbox.SetCell(screenX, screenY, ' ', termbox.ColorDefault, termbox.ColorDefault)
-							screenX++
-						}
-					}
-				}
-				isFirstRowOfLine = false
+// HandleFieldValues prompts for a field and lists the distinct values it has in the
+// lines of the current view with their counts. The selected value can be kept or
+// excluded as a filter.
+func (a *App) HandleFieldValues() {
+	current := a.stack.Current()
+	input, ok := current.promptForInput("u (field: name, .json.path or /regex(group)/): ")
+	input = strings.TrimSpace(input)
+	if !ok || input == "" {
+		return
+	}
+	field, err := newFieldExtractor(input)
+	if err != nil {
+		a.ShowTempMessage(err.Error())
+		return
+	}
 
-				for screenX < current.width && cellIdx < len(cells) {
-					cell := cells[cellIdx]
-					fg, bg := cell.fg, cell.bg
-					if matchPositions != nil && cellIdx < len(matchPositions) && matchPositions[cellIdx] {
-						fg = termbox.ColorBlack
-						bg = termbox.ColorYellow
-					} else if inVisual {
-						fg = termbox.ColorBlack
-						bg = termbox.ColorWhite
-					}
-					termbox.SetCell(screenX, screenY, cell.char, fg, bg)
-					screenX++
-					cellIdx++
-				}
-				// Fill remaining with visual highlight if needed
-				if inVisual {
-					for screenX < current.width {
-						termbox.SetCell(screenX, screenY, ' ', termbox.ColorBlack, termbox.ColorWhite)
-						screenX++
-					}
+	src := current.Snapshot()
+	a.ShowTempMessage("Counting...")
+	a.Draw()
+	values := countValues(src, field.value)
+	a.ClearMessage()
+	if len(values) == 0 {
+		a.ShowTempMessage(fmt.Sprintf("No lines with %s", input))
+		return
+	}
+	total := 0
+	for _, v := range values {
+		total += v.count
+	}
+	title := fmt.Sprintf("%s: %d values in %d lines", input, len(values), total)
+
+	selected := 0
+	byValue := false
+	for {
+		rows := make([]panelRow, len(values))
+		for i, v := range values {
+			rows[i] = panelRow{text: v.value, info: fmt.Sprintf("%d (%.1f%%)", v.count, float64(v.count)*100/float64(total))}
+		}
+		a.drawPanel(title, rows, selected, "&/Enter:keep  -:exclude  s:sort by count/value  g:go to first  q:close")
+
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'u':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			selected = min(selected+1, len(rows)-1)
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			selected = max(selected-1, 0)
+		case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeyCtrlD:
+			selected = min(selected+10, len(rows)-1)
+		case ev.Key == termbox.KeyPgup || ev.Key == termbox.KeyCtrlU:
+			selected = max(selected-10, 0)
+		case ev.Ch == 's':
+			byValue = !byValue
+			if byValue {
+				sortByValue(values)
+			} else {
+				sortByCount(values)
+			}
+			selected = 0
+		case ev.Ch == 'g':
+			current.topLine = values[selected].first
+			current.topLineOffset = 0
+			return
+		case ev.Key == termbox.KeyEnter || ev.Ch == '&' || ev.Ch == '-':
+			spec := field.filter(values[selected].value)
+			spec.op = '&'
+			if ev.Ch == '-' {
+				spec.op = '-'
+			}
+			a.pushFilter(spec)
+			return
+		}
+	}
+}
+
+// sortByValue sorts values numerically if they are all numbers, as text otherwise
+func sortByValue(values []*valueCount) {
+	numeric := true
+	for _, v := range values {
+		_, err := strconv.ParseFloat(v.value, 64)
+		numeric = numeric && err == nil
+	}
+	if numeric {
+		sort.Slice(values, func(i, j int) bool {
+			a, _ := strconv.ParseFloat(values[i].value, 64)
+			b, _ := strconv.ParseFloat(values[j].value, 64)
+			return a < b
+		})
+		return
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+}
+
+// diffNormalizePattern matches what differs between runs of the same program and is
+// ignored when diffing: timestamps, times, UUIDs, hex ids and long numbers
+var diffNormalizePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?|` +
+	`\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b|` +
+	`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b|` +
+	`\b(?:0x)?[0-9a-fA-F]{8,}\b|` +
+	`\b\d{5,}\b`)
+
+// diffMaxCost is the edit distance after which diffLines settles for a longer diff
+// instead of looking further for the shortest one
+const diffMaxCost = 1000
+
+// diffRow is a row of a side by side diff: a line both sides have, or changed lines
+// of A and B (-1 where a side has none)
+type diffRow struct {
+	a, b int
+	same bool
+}
+
+// diffResult is the side by side diff of two views
+type diffResult struct {
+	srcA, srcB lineSource
+	rows       []diffRow
+	hunks      []int // First row of each run of changed rows
+	onlyA      []int // Lines of A that B doesn't have
+	onlyB      []int // Lines of B that A doesn't have
+}
+
+// newDiff diffs the lines of two snapshots, after normalizing them
+func newDiff(srcA, srcB lineSource) *diffResult {
+	// Lines are compared by the id of their normalized text
+	ids := make(map[string]int)
+	normalized := func(src lineSource) []int {
+		result := make([]int, src.Len())
+		for i := range result {
+			line := src.Line(i)
+			if src.HasANSI(i) {
+				line = stripANSI(line)
+			}
+			key := diffNormalizePattern.ReplaceAllString(line, "*")
+			id, ok := ids[key]
+			if !ok {
+				id = len(ids)
+				ids[key] = id
+			}
+			result[i] = id
+		}
+		return result
+	}
+	a, b := normalized(srcA), normalized(srcB)
+
+	d := &diffResult{srcA: srcA, srcB: srcB}
+	nextA, nextB := 0, 0
+	// Changed lines before a match are paired up side by side
+	addChanges := func(toA, toB int) {
+		if nextA < toA || nextB < toB {
+			d.hunks = append(d.hunks, len(d.rows))
+		}
+		for nextA < toA || nextB < toB {
+			row := diffRow{a: -1, b: -1}
+			if nextA < toA {
+				row.a = nextA
+				d.onlyA = append(d.onlyA, nextA)
+				nextA++
+			}
+			if nextB < toB {
+				row.b = nextB
+				d.onlyB = append(d.onlyB, nextB)
+				nextB++
+			}
+			d.rows = append(d.rows, row)
+		}
+	}
+	diffLines(a, b, 0, 0, func(i, j int) {
+		addChanges(i, j)
+		d.rows = append(d.rows, diffRow{a: i, b: j, same: true})
+		nextA, nextB = i+1, j+1
+	})
+	addChanges(len(a), len(b))
+	return d
+}
+
+// diffLines calls match with the pairs of lines a longest common subsequence of a and
+// b is made of, in order (offset by aOff and bOff). It's Myers' linear space
+// algorithm, splitting at the middle snake of the edit graph.
+func diffLines(a, b []int, aOff, bOff int, match func(i, j int)) {
+	// Common prefix and suffix
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		match(aOff, bOff)
+		a, b = a[1:], b[1:]
+		aOff++
+		bOff++
+	}
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	suffixA, suffixB := aOff+len(a)-n, bOff+len(b)-n
+	a, b = a[:len(a)-n], b[:len(b)-n]
+
+	if len(a) > 0 && len(b) > 0 {
+		x, y, u, v := middleSnake(a, b)
+		diffLines(a[:x], b[:y], aOff, bOff, match)
+		for i := x; i < u; i++ {
+			match(aOff+i, bOff+y+i-x)
+		}
+		diffLines(a[u:], b[v:], aOff+u, bOff+v, match)
+	}
+	for i := 0; i < n; i++ {
+		match(suffixA+i, suffixB+i)
+	}
+}
+
+// middleSnake finds the diagonal run of equal lines (x, y) to (u, v) in the middle of
+// a shortest path through the edit graph of a and b, which differ in their first and
+// last lines. Past diffMaxCost it returns the furthest point the forward search got
+// to as an empty run.
+func middleSnake(a, b []int) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+	// Furthest x on each diagonal k = x - y, forward from the start and backward from
+	// the end (in reversed coordinates)
+	vf := make([]int, 2*off+1)
+	vb := make([]int, 2*off+1)
+
+	for d := 0; d <= maxD; d++ {
+		if d > diffMaxCost {
+			// Diagonals of the last forward pass that cross the graph, their furthest
+			// points can lie past its edges
+			x, y = 0, 0
+			for k := -(d - 1); k <= d-1; k += 2 {
+				if k < -m || k > n {
+					continue
+				}
+				kx := min(vf[off+k], n, m+k)
+				if 2*kx-k > x+y {
+					x, y = kx, kx-k
 				}
-				screenY++
-				rowInLine++
+			}
+			return x, y, x, y
+		}
+
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y = x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kr := delta - k; odd && kr >= -(d-1) && kr <= d-1 && x+vb[off+kr] >= n {
+				return x0, y0, x, y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var rx int
+			if k == -d || (k != d && vb[off+k-1] < vb[off+k+1]) {
+				rx = vb[off+k+1]
+			} else {
+				rx = vb[off+k-1] + 1
+			}
+			ry := rx - k
+			rx0, ry0 := rx, ry
+			for rx < n && ry < m && a[n-1-rx] == b[m-1-ry] {
+				rx++
+				ry++
+			}
+			vb[off+k] = rx
+			if kf := delta - k; !odd && kf >= -d && kf <= d && vf[off+kf]+rx >= n {
+				return n - rx, m - ry, n - rx0, m - ry0
 			}
 		}
-		lineIndex++
 	}
+	return 0, 0, 0, 0 // Not reached
 }
 
-// isRowInVisualSelection checks if a specific row (line + offset) is within visual selection
-func (a *App) isRowInVisualSelection(line, rowOffset, startLine, startOff, endLine, endOff int) bool {
-	if line < startLine || line > endLine {
-		return false
-	}
-	if line > startLine && line < endLine {
-		return true
+// HandleDiff prompts for a view of the stack (by level) or a file and shows a side by
+// side diff of the current view against it
+func (a *App) HandleDiff() {
+	current := a.stack.Current()
+	input, ok := current.promptForInput(fmt.Sprintf("d (diff with: level 0-%d or file): ", len(a.stack.viewers)-1))
+	input = strings.TrimSpace(input)
+	if !ok || input == "" {
+		return
 	}
-	if startLine == endLine {
-		return rowOffset >= startOff && rowOffset <= endOff
+
+	var other *Viewer
+	nameB := input
+	if level, err := strconv.Atoi(input); err == nil {
+		if level < 0 || level >= len(a.stack.viewers) {
+			a.ShowTempMessage("No such level")
+			return
+		}
+		other = a.stack.viewers[level]
+		nameB = viewDescription(other)
+	} else {
+		if other, err = NewViewer(input, viewerOptions{}); err != nil {
+			a.ShowTempMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		// Only the diff reads the file
+		defer other.release()
 	}
-	if line == startLine {
-		return rowOffset >= startOff
+
+	// Both sides have to be loaded. Loaders interrupt PollEvent as they go, so the
+	// screen keeps showing their progress until they're done or Esc gives up.
+	a.ShowTempMessage("Diffing... (Esc to cancel)")
+	for current.IsLoading() || other.IsLoading() {
+		a.Draw()
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type == termbox.EventKey && ev.Key == termbox.KeyEsc {
+			a.ClearMessage()
+			return
+		}
 	}
-	if line == endLine {
-		return rowOffset <= endOff
+	a.Draw()
+	d := newDiff(current.Snapshot(), other.Snapshot())
+	a.ClearMessage()
+	if len(d.hunks) == 0 {
+		a.ShowTempMessage("No differences")
+		return
 	}
-	return false
-}
 
-// getMatchPositions returns search match positions for highlighting
-func (a *App) getMatchPositions(cells []ansiCell) []bool {
-	if a.search.query == "" {
-		return nil
+	// Only in B can be pushed if B is a view of the same file
+	var rootB []int
+	if other.root() == current.root() {
+		_, rootB = rootIndices(d.srcB)
 	}
+	_, rootA := rootIndices(d.srcA)
 
-	matchPositions := make([]bool, len(cells))
-	plainText := make([]rune, len(cells))
-	for i, c := range cells {
-		plainText[i] = c.char
-	}
-	plainStr := string(plainText)
+	top, leftCol, hunk := d.hunks[0], 0, 0
+	for {
+		a.drawDiff(d, viewDescription(current), nameB, top, leftCol, hunk)
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			termbox.Sync()
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
 
-	if a.search.regex != nil {
-		// Regex search - use regex for highlighting
-		matches := a.search.regex.FindAllStringIndex(plainStr, -1)
-		for _, match := range matches {
-			startRune := len([]rune(plainStr[:match[0]]))
-			endRune := len([]rune(plainStr[:match[1]]))
-			for j := startRune; j < endRune && j < len(matchPositions); j++ {
-				matchPositions[j] = true
+		_, height := termbox.Size()
+		page := max(height-3, 1)
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || ev.Ch == 'd':
+			return
+		case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+			top++
+		case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+			top--
+		case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeySpace || ev.Key == termbox.KeyCtrlD:
+			top += page
+		case ev.Key == termbox.KeyPgup || ev.Key == termbox.KeyCtrlU:
+			top -= page
+		case ev.Key == termbox.KeyArrowLeft || ev.Ch == 'h':
+			leftCol = max(leftCol-15, 0)
+		case ev.Key == termbox.KeyArrowRight || ev.Ch == 'l':
+			leftCol += 15
+		case ev.Ch == 'n':
+			hunk = min(hunk+1, len(d.hunks)-1)
+			top = d.hunks[hunk]
+		case ev.Ch == 'N':
+			hunk = max(hunk-1, 0)
+			top = d.hunks[hunk]
+		case ev.Ch == 'a' || ev.Ch == 'b':
+			lines, roots := d.onlyA, rootA
+			query := "only in A (" + viewDescription(current) + ") vs " + nameB
+			if ev.Ch == 'b' {
+				if rootB == nil {
+					a.ShowTempMessage("B isn't a view of this file")
+					continue
+				}
+				lines, roots = d.onlyB, rootB
+				query = "only in B (" + nameB + ") vs " + viewDescription(current)
 			}
+			keep := make(map[int]bool, len(lines))
+			for _, i := range lines {
+				keep[roots[i]] = true
+			}
+			a.pushFilter(&filterSpec{op: 'D', query: query, lines: keep})
+			return
 		}
-	} else if a.search.ignoreCase {
-		// Case-insensitive literal search
-		lowerStr := strings.ToLower(plainStr)
-		lowerQuery := strings.ToLower(a.search.query)
-		queryLen := len([]rune(lowerQuery))
-		idx := 0
-		for {
-			pos := strings.Index(lowerStr[idx:], lowerQuery)
-			if pos == -1 {
+		top = max(min(top, len(d.rows)-1), 0)
+		// The hunk shown is the last one starting at or above the top row
+		for hunk = 0; hunk+1 < len(d.hunks) && d.hunks[hunk+1] <= top; hunk++ {
+		}
+	}
+}
+
+// drawDiff draws the side by side diff from row top, A on the left and B on the right.
+// Lines only one side has are red (A) or green (B).
+func (a *App) drawDiff(d *diffResult, nameA, nameB string, top, leftCol, hunk int) {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	width, height := termbox.Size()
+	half := (width - 1) / 2
+	dim := termbox.ColorDefault | termbox.AttrDim
+
+	drawText := func(x, y, w int, text string, fg, bg termbox.Attribute) {
+		col := 0
+		for _, ch := range text {
+			if col >= w {
 				break
 			}
-			// Convert byte position to rune position
-			runePos := len([]rune(lowerStr[:idx+pos]))
-			for j := runePos; j < runePos+queryLen && j < len(matchPositions); j++ {
-				matchPositions[j] = true
-			}
-			idx += pos + 1
+			termbox.SetCell(x+col, y, ch, fg, bg)
+			col++
 		}
-	} else {
-		// Case-sensitive literal search - use strings.Index
-		query := a.search.query
-		queryLen := len([]rune(query))
-		idx := 0
-		for {
-			pos := strings.Index(plainStr[idx:], query)
-			if pos == -1 {
-				break
+	}
+	header := termbox.ColorYellow | termbox.AttrBold
+	drawText(0, 0, half, fmt.Sprintf("A: %s (%d only)", nameA, len(d.onlyA)), header, termbox.ColorDefault)
+	drawText(half+1, 0, width-half-1, fmt.Sprintf("B: %s (%d only)", nameB, len(d.onlyB)), header, termbox.ColorDefault)
+
+	side := func(src lineSource, i, x, w int, fg termbox.Attribute, y int) {
+		if i < 0 {
+			return
+		}
+		line := src.Line(i)
+		if src.HasANSI(i) {
+			line = stripANSI(line)
+		}
+		runes := []rune(strings.ReplaceAll(line, "\t", "    "))
+		if leftCol < len(runes) {
+			drawText(x, y, w, string(runes[leftCol:]), fg, termbox.ColorDefault)
+		}
+	}
+	for y := 1; y < height-1; y++ {
+		termbox.SetCell(half, y, '│', dim, termbox.ColorDefault)
+		r := top + y - 1
+		if r >= len(d.rows) {
+			continue
+		}
+		row := d.rows[r]
+		fgA, fgB := termbox.ColorDefault, termbox.ColorDefault
+		if !row.same {
+			fgA, fgB = termbox.ColorRed, termbox.ColorGreen
+		}
+		side(d.srcA, row.a, 0, half, fgA, y)
+		side(d.srcB, row.b, half+1, width-half-1, fgB, y)
+	}
+
+	status := fmt.Sprintf(" Hunk %d/%d | n/N:next/prev hunk  j/k:scroll  a/b:push only in A/B  q:close", hunk+1, len(d.hunks))
+	for x := 0; x < width; x++ {
+		termbox.SetCell(x, height-1, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	}
+	drawText(0, height-1, width, status, termbox.ColorBlack, termbox.ColorWhite)
+	termbox.Flush()
+}
+
+// newLinesView creates a view of the original viewer with the lines of spec, which
+// refer to lines of the original, so it doesn't depend on the filters before it
+func (a *App) newLinesView(current *Viewer, spec *filterSpec, topLine int) (*Viewer, error) {
+	original := current.root()
+	src := original.Snapshot()
+	newViewer := &Viewer{
+		parent:   original,
+		loading:  true,
+		filename: current.filename,
+		// Lines the original gets later weren't compared
+		match:  func(string, bool) bool { return false },
+		filter: spec,
+	}
+	original.subscribe(newViewer)
+
+	target := current.rootLine(topLine)
+	go func() {
+		foundMatch := false
+		for i := 0; i < src.Len(); i++ {
+			if !spec.lines[i] {
+				continue
 			}
-			// Convert byte position to rune position
-			runePos := len([]rune(plainStr[:idx+pos]))
-			for j := runePos; j < runePos+queryLen && j < len(matchPositions); j++ {
-				matchPositions[j] = true
+			newViewer.mu.Lock()
+			newViewer.originIndices = append(newViewer.originIndices, i)
+			if i >= target && !foundMatch {
+				foundMatch = true
+				newViewer.topLine = len(newViewer.originIndices) - 1
 			}
-			idx += pos + 1
+			newViewer.mu.Unlock()
 		}
-	}
-	return matchPositions
+		newViewer.finishLoading(src.Len())
+	}()
+	return newViewer, nil
 }
 
-func (v *Viewer) run() error {
+// run shows v, and each of tabs in a tab of its own, until the user quits. Files opened
+// from there get opts.
+func (v *Viewer) run(tabs []*Viewer, opts viewerOptions) error {
 	fmt.Print("\033[?1049h\033[H")
 	defer fmt.Print("\033[?1049l")
 
@@ -3104,6 +8181,13 @@ func (v *Viewer) run() error {
 	termbox.SetOutputMode(termbox.Output256)
 
 	app := NewApp(v)
+	app.opts = opts
+	for _, t := range tabs {
+		app.addTab(t)
+	}
+	if len(tabs) > 0 {
+		app.focusTab(0)
+	}
 	app.Draw()
 
 	for {
@@ -3200,8 +8284,56 @@ func (v *Viewer) run() error {
 					app.HandleSetTimestampFormat()
 				case 'b':
 					app.HandleTimestampSearch()
+				case 'T':
+					app.HandleTimeRangeFilter()
+				case '!':
+					app.HandleLevelFilter()
+				case 'i':
+					app.HandleTimeline()
+				case 'p':
+					app.HandleTemplates()
+				case 'u':
+					app.HandleFieldValues()
+				case 'd':
+					app.HandleDiff()
+				case 'R':
+					app.HandleRecordMode()
 				case 'U':
 					app.HandleStackNav(false)
+				case 'S':
+					app.HandleFilterStack()
+				case 'c':
+					app.HandleHighlights()
+				case 'C':
+					app.levelColors = !app.levelColors
+				case 'e':
+					app.HandleLevelJump(false)
+				case 'E':
+					app.HandleLevelJump(true)
+				case 'V':
+					app.HandleSetJumpLevel()
+				case '[':
+					app.HandleBranchNav(-1)
+				case ']':
+					app.HandleBranchNav(1)
+				case 'D':
+					app.HandleBranchNav(0)
+				case 'X':
+					app.HandleBranchClose()
+				case 'm':
+					app.HandleSetMark()
+				case '\'':
+					app.HandleJumpToMark()
+				case 'M':
+					app.HandleMarks()
+				case 'a':
+					app.HandleNote()
+				case 'A':
+					app.HandleNotes()
+				case 'o':
+					app.HandleOpenTab()
+				case 'x':
+					app.HandleCloseTab()
 				}
 			} else {
 				switch ev.Key {
@@ -3253,8 +8385,17 @@ func (v *Viewer) run() error {
 					}
 				case termbox.KeyCtrlC:
 					return nil
+				case termbox.KeyCtrlW:
+					app.HandlePaneCommand()
+				case termbox.KeyTab, termbox.KeyCtrlN:
+					app.HandleNextTab(1)
+				case termbox.KeyCtrlP:
+					app.HandleNextTab(-1)
 				}
 			}
+			if app.syncTime {
+				app.syncPanes()
+			}
 			app.Draw()
 
 		case termbox.EventResize:
@@ -3273,170 +8414,213 @@ func (v *Viewer) run() error {
 // fileStream represents an open file with its current line buffered
 type fileStream struct {
 	scanner   *bufio.Scanner
-	file      *os.File
-	fileIdx   int
+	file      io.ReadCloser
 	prefix    string
 	currLine  string
 	currTime  time.Time
 	hasTime   bool
 	exhausted bool
+	record    []string // Continuation lines of the current line in record mode
+	next      string   // Line read ahead of the current one
+	hasNext   bool
 }
 
-// NewViewerFromMultipleFiles creates a viewer by streaming and merging multiple files by timestamp
-func NewViewerFromMultipleFiles(filenames []string) (*Viewer, error) {
-	if len(filenames) == 0 {
-		return nil, fmt.Errorf("no files provided")
+// newFileStream creates a stream whose lines are shown with prefix
+func newFileStream(r io.ReadCloser, prefix string) *fileStream {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+	return &fileStream{scanner: scanner, file: r, prefix: prefix}
+}
+
+// setLine buffers line as the current line of the stream
+func (s *fileStream) setLine(line, format string) {
+	s.currLine = s.prefix + line
+	s.hasTime = false
+	if format != "" {
+		if ts, ok := extractTimestamp(line, format); ok {
+			s.currTime = ts
+			s.hasTime = true
+		}
 	}
-	if len(filenames) == 1 {
-		return NewViewer(filenames[0])
+}
+
+// advance buffers the next line of the stream, and in record mode the continuation
+// lines after it. It returns false at the end of the stream.
+func (s *fileStream) advance(format string, records *recordRule) bool {
+	line := s.next
+	if !s.hasNext {
+		if !s.scanner.Scan() {
+			return false
+		}
+		line = s.scanner.Text()
 	}
+	s.hasNext = false
+	s.setLine(line, format)
 
-	// Build filename legend
-	var legend []string
-	for i, name := range filenames {
-		legend = append(legend, fmt.Sprintf("%d> %s", i, name))
+	s.record = nil
+	for records != nil && s.scanner.Scan() {
+		line := s.scanner.Text()
+		if records.isStart(line) {
+			s.next, s.hasNext = line, true
+			break
+		}
+		s.record = append(s.record, s.prefix+line)
 	}
-	legendStr := strings.Join(legend, " ")
+	return true
+}
 
-	v := &Viewer{
-		lines:    nil,
-		loading:  true,
-		filename: legendStr,
-		topLine:  0,
-		leftCol:  0,
+// mergeStreams k-way merges streams by timestamp and passes the merged lines to emit in
+// batches. Streams are read to the end but not closed. With records set, records move
+// as a whole so continuation lines stay under the line starting them.
+func mergeStreams(streams []*fileStream, records *recordRule, emit func(batch []string)) {
+	var detectedFormat string
+	for _, s := range streams {
+		// Read first line to prime the stream
+		if !s.scanner.Scan() {
+			s.exhausted = true
+			continue
+		}
+		s.next, s.hasNext = s.scanner.Text(), true
+
+		// Try to detect format from first line if not set
+		if detectedFormat == "" {
+			detectedFormat = detectTimestampFormat(s.next)
+		}
+	}
+	if records != nil && records.start == nil && records.format == "" {
+		records = &recordRule{format: detectedFormat}
+	}
+	for _, s := range streams {
+		if !s.exhausted {
+			s.advance(detectedFormat, records)
+		}
 	}
 
-	go func() {
-		// Open all files and create streams
-		var streams []*fileStream
-		var detectedFormat string
+	// K-way merge: always pick the stream with the oldest timestamp
+	const batchSize = 10000
+	batch := make([]string, 0, batchSize)
 
-		for fileIdx, filename := range filenames {
-			file, err := os.Open(filename)
-			if err != nil {
+	for {
+		// Find stream to pick: prioritize lines without timestamps, then oldest timestamp
+		var picked *fileStream
+		for _, s := range streams {
+			if s.exhausted {
 				continue
 			}
-
-			scanner := bufio.NewScanner(file)
-			buf := make([]byte, 0, 64*1024)
-			scanner.Buffer(buf, 10*1024*1024)
-
-			stream := &fileStream{
-				scanner: scanner,
-				file:    file,
-				fileIdx: fileIdx,
-				prefix:  fmt.Sprintf("%d> ", fileIdx),
+			if picked == nil {
+				picked = s
+			} else if !s.hasTime && picked.hasTime {
+				// Lines without timestamp are output immediately (priority)
+				picked = s
+			} else if s.hasTime && !picked.hasTime {
+				// Keep the one without timestamp (it has priority)
+				// picked stays
+			} else if s.hasTime && picked.hasTime {
+				// Both have timestamps: pick the oldest
+				if s.currTime.Before(picked.currTime) {
+					picked = s
+				}
 			}
+			// If neither has timestamp, keep first found (preserve order)
+		}
 
-			// Read first line to prime the stream
-			if scanner.Scan() {
-				line := scanner.Text()
-				stream.currLine = stream.prefix + line
+		// All streams exhausted
+		if picked == nil {
+			break
+		}
 
-				// Try to detect format from first line if not set
-				if detectedFormat == "" {
-					detectedFormat = detectTimestampFormat(line)
-				}
+		// Add the picked line (and the rest of its record) to batch
+		batch = append(batch, picked.currLine)
+		batch = append(batch, picked.record...)
 
-				// Parse timestamp
-				if detectedFormat != "" {
-					if ts, ok := extractTimestamp(line, detectedFormat); ok {
-						stream.currTime = ts
-						stream.hasTime = true
-					}
-				}
-			} else {
-				stream.exhausted = true
-				file.Close()
-			}
+		// Advance that stream to its next line
+		if !picked.advance(detectedFormat, records) {
+			picked.exhausted = true
+		}
 
-			streams = append(streams, stream)
+		// Flush batch periodically
+		if len(batch) >= batchSize {
+			emit(batch)
+			batch = make([]string, 0, batchSize)
 		}
+	}
 
-		// K-way merge: always pick the stream with the oldest timestamp
-		const batchSize = 10000
-		batch := make([]string, 0, batchSize)
-		batchHasANSI := make([]bool, 0, batchSize)
-		totalLines := 0
+	// Append remaining
+	if len(batch) > 0 {
+		emit(batch)
+	}
+}
 
-		for {
-			// Find stream to pick: prioritize lines without timestamps, then oldest timestamp
-			var picked *fileStream
-			for _, s := range streams {
-				if s.exhausted {
-					continue
-				}
-				if picked == nil {
-					picked = s
-				} else if !s.hasTime && picked.hasTime {
-					// Lines without timestamp are output immediately (priority)
-					picked = s
-				} else if s.hasTime && !picked.hasTime {
-					// Keep the one without timestamp (it has priority)
-					// picked stays
-				} else if s.hasTime && picked.hasTime {
-					// Both have timestamps: pick the oldest
-					if s.currTime.Before(picked.currTime) {
-						picked = s
-					}
-				}
-				// If neither has timestamp, keep first found (preserve order)
-			}
+// NewViewerFromMultipleFiles creates a viewer by streaming and merging multiple files by timestamp
+// In record mode continuation lines are kept together with the line starting their record.
+func NewViewerFromMultipleFiles(filenames []string, opts viewerOptions) (*Viewer, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files provided")
+	}
+	if len(filenames) == 1 {
+		return NewViewer(filenames[0], opts)
+	}
+	records := opts.records
 
-			// All streams exhausted
-			if picked == nil {
-				break
+	// Build filename legend
+	var legend []string
+	for i, name := range filenames {
+		legend = append(legend, fmt.Sprintf("%d> %s", i, name))
+	}
+	legendStr := strings.Join(legend, " ")
+
+	// Open all files and create streams, a file that can't be read fails the whole view
+	var streams []*fileStream
+	for fileIdx, filename := range filenames {
+		file, err := openDecompressed(filename)
+		if err != nil {
+			for _, s := range streams {
+				s.file.Close()
 			}
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		streams = append(streams, newFileStream(file, fmt.Sprintf("%d> ", fileIdx)))
+	}
 
-			// Add the picked line to batch
-			batch = append(batch, picked.currLine)
-			batchHasANSI = append(batchHasANSI, lineHasANSI(picked.currLine))
+	v := newViewer(legendStr, opts)
+	v.multiFile = true
 
-			// Advance that stream to its next line
-			if picked.scanner.Scan() {
-				line := picked.scanner.Text()
-				picked.currLine = picked.prefix + line
-				picked.hasTime = false
+	go func() {
 
-				if detectedFormat != "" {
-					if ts, ok := extractTimestamp(line, detectedFormat); ok {
-						picked.currTime = ts
-						picked.hasTime = true
-					}
-				}
-			} else {
-				picked.exhausted = true
-				picked.file.Close()
+		totalLines := 0
+		mergeStreams(streams, records, func(batch []string) {
+			v.appendLines(batch)
+			totalLines += len(batch)
+			if totalLines == len(batch) || totalLines%100000 == 0 {
+				termbox.Interrupt()
 			}
-
-			// Flush batch periodically
-			if len(batch) >= batchSize {
-				v.mu.Lock()
-				v.lines = append(v.lines, batch...)
-				v.hasANSI = append(v.hasANSI, batchHasANSI...)
-				v.mu.Unlock()
-				totalLines += len(batch)
-				batch = batch[:0]
-				batchHasANSI = batchHasANSI[:0]
-
-				if totalLines == batchSize || totalLines%100000 == 0 {
-					termbox.Interrupt()
-				}
+		})
+
+		// Plain files stay open to be followed from where the merge stopped
+		var merged []*followState
+		for i, s := range streams {
+			file, ok := s.file.(*os.File)
+			if !ok {
+				s.file.Close()
+				continue
 			}
-		}
-
-		// Append remaining
-		if len(batch) > 0 {
-			v.mu.Lock()
-			v.lines = append(v.lines, batch...)
-			v.hasANSI = append(v.hasANSI, batchHasANSI...)
-			v.mu.Unlock()
+			f := &followState{filename: filenames[i], prefix: s.prefix, file: file}
+			f.info, _ = file.Stat()
+			f.offset, _ = file.Seek(0, io.SeekCurrent)
+			merged = append(merged, f)
 		}
 
 		v.mu.Lock()
+		v.merged = merged
 		v.loading = false
 		v.mu.Unlock()
 		termbox.Interrupt()
+
+		// If follow mode is enabled, keep merging new lines from every file
+		if v.follow.Load() {
+			go v.followMerged()
+		}
 	}()
 
 	return v, nil
@@ -3448,6 +8632,10 @@ func main() {
 	// Parse command line flags
 	followFlag := flag.Bool("f", false, "Follow mode (like tail -f)")
 	followLongFlag := flag.Bool("follow", false, "Follow mode (like tail -f)")
+	pollFlag := flag.Duration("poll-interval", 0, "Poll for changes at this interval in follow mode instead of using inotify")
+	recordsFlag := flag.Bool("records", false, "Group continuation lines into records")
+	recordStartFlag := flag.String("record-start", "", "Regex matching the first line of each record (implies --records)")
+	tabsFlag := flag.Bool("tabs", false, "Open each file in a tab instead of merging them")
 	lineNumFlag := flag.Bool("l", false, "Show line numbers")
 	helpFlag := flag.Bool("h", false, "Show help")
 	helpLongFlag := flag.Bool("help", false, "Show help")
@@ -3459,6 +8647,14 @@ func main() {
 		fmt.Fprintf(os.Stderr, "       command | sieve\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "  -f, --follow    Follow mode (like tail -f)\n")
+		fmt.Fprintf(os.Stderr, "      --poll-interval <duration>\n")
+		fmt.Fprintf(os.Stderr, "                  Poll for changes in follow mode (e.g. 500ms) instead of\n")
+		fmt.Fprintf(os.Stderr, "                  inotify, for filesystems like NFS where it doesn't work\n")
+		fmt.Fprintf(os.Stderr, "      --records   Group indented or untimestamped lines with the line above\n")
+		fmt.Fprintf(os.Stderr, "                  them, filters, search, merge and export use whole records\n")
+		fmt.Fprintf(os.Stderr, "      --record-start <regex>\n")
+		fmt.Fprintf(os.Stderr, "                  Start records at lines matching regex (implies --records)\n")
+		fmt.Fprintf(os.Stderr, "      --tabs      Open each file in a tab of its own instead of merging them\n")
 		fmt.Fprintf(os.Stderr, "  -l              Show line numbers\n")
 		fmt.Fprintf(os.Stderr, "  -h, --help      Show this help message\n")
 		fmt.Fprintf(os.Stderr, "      --version   Show version\n\n")
@@ -3480,24 +8676,53 @@ func main() {
 	follow := *followFlag || *followLongFlag
 	args := flag.Args()
 
+	var records *recordRule
+	if *recordsFlag || *recordStartFlag != "" {
+		records = &recordRule{}
+	}
+	if *recordStartFlag != "" {
+		re, err := regexp.Compile(*recordStartFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --record-start regex: %v\n", err)
+			os.Exit(1)
+		}
+		records.start = re
+	}
+
 	var viewer *Viewer
+	var tabs []*Viewer // Files opened in tabs after the first with --tabs
 	var err error
+	opts := viewerOptions{follow: follow, pollInterval: *pollFlag, records: records}
 
 	// Check if data is being piped via stdin
 	stat, _ := os.Stdin.Stat()
 	if (stat.Mode() & os.ModeCharDevice) == 0 {
 		// stdin has data (pipe or redirect)
-		viewer = NewViewerFromStdin()
+		viewer = NewViewerFromStdin(opts)
+	} else if len(args) >= 2 && *tabsFlag {
+		// Multiple files - one tab each
+		for i, filename := range args {
+			v, err := NewViewer(filename, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading file: %v\n", err)
+				os.Exit(1)
+			}
+			if i == 0 {
+				viewer = v
+			} else {
+				tabs = append(tabs, v)
+			}
+		}
 	} else if len(args) >= 2 {
 		// Multiple files - merge sort by timestamp
-		viewer, err = NewViewerFromMultipleFiles(args)
+		viewer, err = NewViewerFromMultipleFiles(args, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading files: %v\n", err)
 			os.Exit(1)
 		}
 	} else if len(args) >= 1 {
 		// Single file
-		viewer, err = NewViewer(args[0])
+		viewer, err = NewViewer(args[0], opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading file: %v\n", err)
 			os.Exit(1)
@@ -3507,11 +8732,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Set follow mode and line numbers
-	viewer.follow = follow
-	viewer.showLineNumbers = *lineNumFlag
+	for _, v := range append([]*Viewer{viewer}, tabs...) {
+		v.showLineNumbers = *lineNumFlag
+	}
 
-	if err := viewer.run(); err != nil {
+	if err := viewer.run(tabs, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
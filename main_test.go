@@ -0,0 +1,459 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestCompileExpr(t *testing.T) {
+	tests := []struct {
+		query string
+		line  string
+		want  bool
+	}{
+		{"ERROR and (db or cache)", "ERROR db timeout", true},
+		{"ERROR and (db or cache)", "ERROR disk full", false},
+		{"ERROR not timeout", "ERROR db timeout", false},
+		{`"a b" || c`, "x a b y", true},
+		{"/conn(ection)? refused/i", "Connection REFUSED", true},
+		{"/api/v1", "GET /api/v1/users", true},
+		{"/api/v1", "GET /api/v2/users", false},
+	}
+	for _, tt := range tests {
+		match, _, err := compileExpr(tt.query, false)
+		if err != nil {
+			t.Errorf("compileExpr(%q): %v", tt.query, err)
+			continue
+		}
+		if got := match(tt.line); got != tt.want {
+			t.Errorf("compileExpr(%q) on %q = %v, want %v", tt.query, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	for _, query := range []string{"", "(a", "a)", "a and", `"open`, "/open", "not"} {
+		if _, _, err := compileExpr(query, false); err == nil {
+			t.Errorf("compileExpr(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestTokenizeExprRegexFlags(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []exprToken
+	}{
+		{"/err/i", []exprToken{{kind: exprRegex, text: "err", flags: "i"}}},
+		{"/err/", []exprToken{{kind: exprRegex, text: "err"}}},
+		{"/err/i&&x", []exprToken{{kind: exprRegex, text: "err", flags: "i"}, {kind: exprAnd}, {kind: exprWord, text: "x"}}},
+		{"/api/v1", []exprToken{{kind: exprWord, text: "/api/v1"}}},
+		{"(/var/log)", []exprToken{{kind: exprLParen}, {kind: exprWord, text: "/var/log"}, {kind: exprRParen}}},
+	}
+	for _, tt := range tests {
+		got, err := tokenizeExpr(tt.query)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeExpr(%q) = %+v, %v, want %+v", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestCompileExprFields(t *testing.T) {
+	tests := []struct {
+		query string
+		line  string
+		want  bool
+	}{
+		{`.level == "error" && .latency_ms > 500`, `{"level":"error","latency_ms":700}`, true},
+		{`.level == "error" && .latency_ms > 500`, `{"level":"error","latency_ms":70}`, false},
+		{".items[0].id == 7", `{"items":[{"id":7}]}`, true},
+	}
+	for _, tt := range tests {
+		match, _, err := compileExpr(tt.query, false)
+		if err != nil {
+			t.Errorf("compileExpr(%q): %v", tt.query, err)
+			continue
+		}
+		if got := match(tt.line); got != tt.want {
+			t.Errorf("compileExpr(%q) on %q = %v, want %v", tt.query, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestKeyComparePattern(t *testing.T) {
+	tests := []struct {
+		word string
+		key  string
+		op   string
+	}{
+		{"dur>100ms", "dur", ">"},
+		{"user=", "user", "="},
+		{"a.b-c==1", "a.b-c", "=="},
+		{"msg=~/x/", "msg", "=~"},
+		{"a->b", "", ""},
+		{"x=>y", "", ""},
+		{"a!==b", "", ""},
+		{"-x=1", "", ""},
+	}
+	for _, tt := range tests {
+		m := keyComparePattern.FindStringSubmatch(tt.word)
+		var key, op string
+		if m != nil {
+			key, op = m[1], m[2]
+		}
+		if key != tt.key || op != tt.op {
+			t.Errorf("keyComparePattern on %q = %q %q, want %q %q", tt.word, key, op, tt.key, tt.op)
+		}
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{`level=info msg="a b" dur=3ms`, map[string]string{"level": "info", "msg": "a b", "dur": "3ms"}, false},
+		{`a=1 a=2 b=`, map[string]string{"a": "1", "b": ""}, false},
+		{`GET /x 200 user=bob`, map[string]string{"user": "bob"}, false},
+		{`b="x\"y" c`, map[string]string{"b": `x"y`}, false},
+		{`say"hi there" k=v`, map[string]string{"k": "v"}, false},
+		{`msg="abc level=error`, nil, true},
+		{`foo"bar level=error`, nil, true},
+		{``, map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseLogfmt(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLogfmt(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLogfmt(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExprLogfmt(t *testing.T) {
+	tests := []struct {
+		query string
+		line  string
+		want  bool
+	}{
+		{"a->b", "edge a->b", true},
+		{"a->b", "b=x", false},
+		{"dur>100ms", "msg=done dur=1.5s", true},
+		{"dur>100ms", "msg=done dur=50ms", false},
+		{"user!=healthcheck", "user=alice", true},
+		{`msg="a b"`, `level=info msg="a b"`, true},
+		{"level=error", `msg="unterminated level=error`, false},
+	}
+	for _, tt := range tests {
+		match, _, err := compileExpr(tt.query, false)
+		if err != nil {
+			t.Errorf("compileExpr(%q): %v", tt.query, err)
+			continue
+		}
+		if got := match(tt.line); got != tt.want {
+			t.Errorf("compileExpr(%q) on %q = %v, want %v", tt.query, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	day := func(hour, min int) time.Time {
+		return time.Date(2026, 10, 15, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		input string
+		ts    time.Time
+		want  bool
+	}{
+		{"10:02..10:05", day(10, 5).Add(59 * time.Second), true},
+		{"10:02..10:05", day(10, 6), false},
+		{"10:02..10:05", day(10, 1), false},
+		{"10:02..10:05", day(10, 3).AddDate(0, 0, 3), true},
+		{"22:00..02:00", day(23, 30), true},
+		{"22:00..02:00", day(1, 30), true},
+		{"22:00..02:00", day(3, 0), false},
+		{"22:00..+4h", day(1, 59), true},
+		{"-1h..00:30", day(23, 31), true},
+		{"-1h..00:30", day(23, 30), false},
+		{"2026-10-15T22:00..+15m", day(22, 14), true},
+		{"2026-10-15T22:00..+15m", day(22, 15), false},
+		{"-5m..2026-10-15 22:00", day(21, 56), true},
+		{"-5m..2026-10-15 22:00", day(21, 55), false},
+		{"-5m..2026-10-15 22:00", day(22, 0).Add(59 * time.Second), true},
+		{"2026-10-16..", day(23, 59), false},
+		{"2026-10-16..", day(0, 0).AddDate(0, 0, 1), true},
+		{"..2026-10-15", day(23, 59), true},
+		{"..10:00", day(9, 59), true},
+		{"10:00:00.5..10:00:01", day(10, 0).Add(600 * time.Millisecond), true},
+		{"10:00:00.5..10:00:01", day(10, 0).Add(400 * time.Millisecond), false},
+	}
+	for _, tt := range tests {
+		r, err := parseTimeRange(tt.input)
+		if err != nil {
+			t.Errorf("parseTimeRange(%q): %v", tt.input, err)
+			continue
+		}
+		if got := r.contains(tt.ts); got != tt.want {
+			t.Errorf("parseTimeRange(%q).contains(%s) = %v, want %v", tt.input, tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRangeErrors(t *testing.T) {
+	for _, input := range []string{"", "..", "10:00", "-5m..+5m", "-5m..", "..+5m", "2026-10-15 10:00..11:00", "noon..1pm", "-x..10:00"} {
+		if _, err := parseTimeRange(input); err == nil {
+			t.Errorf("parseTimeRange(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestContainsYearless(t *testing.T) {
+	syslog := func(s string) time.Time {
+		ts, err := time.Parse(pythonToGoFormat("%b %_d %H:%M:%S"), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		input string
+		ts    string
+		want  bool
+	}{
+		{"2026-10-15 10:05..2026-10-15 10:07", "Oct 15 10:06:00", true},
+		{"2026-10-15 10:05..2026-10-15 10:07", "Oct 16 10:06:00", false},
+		{"2026-12-31 23:58..2027-01-01 00:05", "Dec 31 23:59:00", true},
+		{"2026-12-31 23:58..2027-01-01 00:05", "Jan  1 00:01:00", true},
+		{"2026-12-31 23:58..2027-01-01 00:05", "Jan  1 00:09:00", false},
+		{"2026-10-15..", "Oct 20 00:00:00", true},
+	}
+	for _, tt := range tests {
+		r, err := parseTimeRange(tt.input)
+		if err != nil {
+			t.Fatalf("parseTimeRange(%q): %v", tt.input, err)
+		}
+		if got := r.containsYearless(syslog(tt.ts)); got != tt.want {
+			t.Errorf("parseTimeRange(%q).containsYearless(%q) = %v, want %v", tt.input, tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLevel(t *testing.T) {
+	tests := []struct {
+		line string
+		want logLevel
+	}{
+		{"2026-10-15 10:00:00 ERROR db down", levelError},
+		{"2026-10-15 10:00:00 WARN slow", levelWarn},
+		{"[error] disk full", levelError},
+		{"an error happened", levelNone},
+		{"level=debug msg=x", levelDebug},
+		{`{"level":"warn","msg":"x"}`, levelWarn},
+		{`{"level":50,"msg":"x"}`, levelError},
+		{"<11>Oct 15 10:00:00 host app: x", levelError},
+		{"<14>Oct 15 10:00:00 host app: x", levelInfo},
+		{"INFO then ERROR", levelInfo},
+		{"plain line", levelNone},
+	}
+	for _, tt := range tests {
+		if got := detectLevel(tt.line); got != tt.want {
+			t.Errorf("detectLevel(%q) = %s, want %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input string
+		want  logLevel
+		ok    bool
+	}{
+		{"warn", levelWarn, true},
+		{" Warning ", levelWarn, true},
+		{"ERR", levelError, true},
+		{"crit", levelFatal, true},
+		{"loud", levelNone, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLevel(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseLevel(%q) = %s, %v, want %s, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTemplateOf(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"took 35 ms on 10.0.0.1:8080", "took <NUM> ms on <IP>"},
+		{`user "bob" id 550e8400-e29b-41d4-a716-446655440000`, "user <STR> id <UUID>"},
+		{"addr 0xdeadbeef", "addr <HEX>"},
+		{"no tokens here", "no tokens here"},
+	}
+	for _, tt := range tests {
+		if got := templateOf(tt.line); got != tt.want {
+			t.Errorf("templateOf(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestTemplatePattern(t *testing.T) {
+	re := regexp.MustCompile(templatePattern(`ERROR id=12 "x y" failed`))
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{`ERROR id=99 "a" failed`, true},
+		{`ERROR id=99 "a" failed later`, false},
+		{`WARN ERROR id=99 "a" failed`, false},
+		{"ERROR id=1 \"a\" failed\n  at main.go:10", true},
+		{"start\nERROR id=1 \"\" failed", true},
+		{"ERROR id=1 \"a\nb\" failed", false},
+	}
+	for _, tt := range tests {
+		if got := re.MatchString(tt.text); got != tt.want {
+			t.Errorf("template pattern %s on %q = %v, want %v", re, tt.text, got, tt.want)
+		}
+	}
+}
+
+// lcsLength is the length of a longest common subsequence of a and b, by dynamic
+// programming
+func lcsLength(a, b []int) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkDiffLines checks that diffLines pairs equal lines of a and b in order, and as
+// many as a longest common subsequence has
+func checkDiffLines(t *testing.T, a, b []int) {
+	t.Helper()
+	lastI, lastJ, n := -1, -1, 0
+	diffLines(a, b, 0, 0, func(i, j int) {
+		if i <= lastI || j <= lastJ || a[i] != b[j] {
+			t.Errorf("diffLines(%v, %v) matched %d with %d after %d with %d", a, b, i, j, lastI, lastJ)
+		}
+		lastI, lastJ = i, j
+		n++
+	})
+	if want := lcsLength(a, b); n != want {
+		t.Errorf("diffLines(%v, %v) matched %d lines, want %d", a, b, n, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct{ a, b []int }{
+		{nil, nil},
+		{[]int{1, 2, 3}, nil},
+		{nil, []int{1, 2, 3}},
+		{[]int{1, 2, 3}, []int{1, 2, 3}},
+		{[]int{1, 2, 3}, []int{4, 5, 6}},
+		{[]int{1, 2, 3, 4}, []int{1, 3, 4}},
+		{[]int{1, 3, 4}, []int{1, 2, 3, 4}},
+		{[]int{1, 2, 3, 1, 2, 2, 1}, []int{3, 2, 1, 2, 1, 3}},
+	}
+	for _, tt := range tests {
+		checkDiffLines(t, tt.a, tt.b)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	random := func() []int {
+		s := make([]int, r.Intn(40))
+		for i := range s {
+			s[i] = r.Intn(4)
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		checkDiffLines(t, random(), random())
+	}
+}
+
+func TestDiffLinesPastMaxCost(t *testing.T) {
+	// Sides with no line in common and lengths far apart: past diffMaxCost the search
+	// gives up on diagonals that run off the shorter side
+	lines := func(n, from int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = from + i
+		}
+		return s
+	}
+	tests := []struct{ n, m int }{
+		{3000, 1},
+		{1, 3000},
+		{5000, 500},
+		{500, 5000},
+	}
+	for _, tt := range tests {
+		checkDiffLines(t, lines(tt.n, 0), lines(tt.m, tt.n))
+	}
+}
+
+func TestMiddleSnake(t *testing.T) {
+	tests := []struct{ a, b []int }{
+		{[]int{1}, []int{2}},
+		{[]int{1, 2, 3}, []int{4, 2, 5}},
+		{[]int{1, 2, 3, 4, 5}, []int{6, 2, 3, 7}},
+		{[]int{1, 5, 5, 5, 2}, []int{3, 5, 4}},
+		{[]int{1, 2}, []int{3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		x, y, u, v := middleSnake(tt.a, tt.b)
+		if x < 0 || y < 0 || u > len(tt.a) || v > len(tt.b) || u-x != v-y || u < x {
+			t.Errorf("middleSnake(%v, %v) = %d, %d, %d, %d, not a diagonal in the graph", tt.a, tt.b, x, y, u, v)
+			continue
+		}
+		for i := x; i < u; i++ {
+			if tt.a[i] != tt.b[y+i-x] {
+				t.Errorf("middleSnake(%v, %v) = %d, %d, %d, %d, lines %d and %d differ", tt.a, tt.b, x, y, u, v, i, y+i-x)
+			}
+		}
+		// The snake splits the graph into two halves whose LCS add up to the whole
+		if got, want := lcsLength(tt.a[:x], tt.b[:y])+(u-x)+lcsLength(tt.a[u:], tt.b[v:]), lcsLength(tt.a, tt.b); got != want {
+			t.Errorf("middleSnake(%v, %v) = %d, %d, %d, %d, isn't on a shortest path (%d common lines, want %d)", tt.a, tt.b, x, y, u, v, got, want)
+		}
+	}
+}
+
+func TestIsBzip2(t *testing.T) {
+	block := []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	eos := []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"block", append([]byte("BZh9"), block...), true},
+		{"empty stream", append([]byte("BZh1"), eos...), true},
+		{"block size 0", append([]byte("BZh0"), block...), false},
+		{"no block magic", []byte("BZh9 is not bzip2"), false},
+		{"short", []byte("BZh9"), false},
+		{"text", []byte("BZh9 plain text"), false},
+	}
+	for _, tt := range tests {
+		if got := isBzip2(tt.header); got != tt.want {
+			t.Errorf("isBzip2(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of file into memory on platforms without mmap.
+// There's no room to grow into, capacity is ignored.
+func mmapFile(file *os.File, size, capacity int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(file, 0, size), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile does nothing, the data read by mmapFile is garbage collected
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps file read-only into memory and returns its first size bytes. capacity
+// bytes are mapped, so a growing file can be read further without mapping it again
+// (the pages past its end become readable as the file grows over them).
+func mmapFile(file *os.File, size, capacity int64) ([]byte, error) {
+	if capacity == 0 {
+		return nil, nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(capacity), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+// munmapFile unmaps data returned by mmapFile, with the room mapped past its end
+func munmapFile(data []byte) error {
+	if cap(data) == 0 {
+		return nil
+	}
+	return syscall.Munmap(data[:cap(data)])
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// notifyWakeup bounds how long the follower sleeps without events, so it still
+// notices follow mode being turned off
+const notifyWakeup = time.Second
+
+// inotifyWatcher wakes the follower when a followed file is written, created or renamed.
+// Directories are watched rather than files, so a file rotated into place is seen too.
+type inotifyWatcher struct {
+	file  *os.File
+	names map[int32]map[string]bool // Followed base names by directory watch descriptor
+	buf   []byte
+}
+
+// newNotifyWatcher starts watching the directories of filenames with inotify
+func newNotifyWatcher(filenames []string) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	mask := uint32(syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+		syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO)
+	names := make(map[int32]map[string]bool)
+	for _, filename := range filenames {
+		// Adding a directory twice returns the same descriptor
+		wd, err := syscall.InotifyAddWatch(fd, filepath.Dir(filename), mask)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+		if names[int32(wd)] == nil {
+			names[int32(wd)] = make(map[string]bool)
+		}
+		names[int32(wd)][filepath.Base(filename)] = true
+	}
+	// A non-blocking descriptor goes through the runtime poller, so reads honor deadlines
+	return &inotifyWatcher{
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		names: names,
+		buf:   make([]byte, 64*1024),
+	}, nil
+}
+
+// Wait blocks until an event for a followed file arrives or notifyWakeup passes
+func (w *inotifyWatcher) Wait() {
+	w.file.SetReadDeadline(time.Now().Add(notifyWakeup))
+	for {
+		n, err := w.file.Read(w.buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&w.buf[off]))
+			name := w.buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(event.Len)]
+			if w.names[event.Wd][string(bytes.TrimRight(name, "\x00"))] || event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				return
+			}
+			off += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
+
+func (w *inotifyWatcher) Close() {
+	w.file.Close()
+}
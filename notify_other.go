@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newNotifyWatcher reports that file change notifications aren't supported here
+func newNotifyWatcher(filenames []string) (fileWatcher, error) {
+	return nil, errors.New("file change notifications not supported")
+}